@@ -20,12 +20,22 @@ import (
 	"github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+const (
+	//存在该annotation时暂停调谐,不再修改任何资源,只刷新status.删除Cluster时忽略该annotation
+	PausedAnnotation = "kok.tanx/paused"
+	//值变化时强制完整调谐一次(忽略重试退避和探测周期),处理过的值记录在status.lastHandledReconcileAt
+	ReconcileAtAnnotation = "kok.tanx/reconcile-at"
+	//deletionPolicy为Snapshot时,存在该annotation则跳过快照(快照失败后)按Delete策略继续删除
+	SkipSnapshotAnnotation = "kok.tanx/skip-snapshot"
+)
+
 type ImageBase struct {
 	Image string `json:"image"`
 }
@@ -43,9 +53,95 @@ type ClusterEtcdSpec struct {
 	Count int `json:"count"`
 }
 
+type ClusterEncryptionSpec struct {
+	//aescbc,secretbox
+	Provider string `json:"provider,omitempty"`
+	//增大该值会触发一次密钥轮换
+	RotationGeneration int64 `json:"rotationGeneration,omitempty"`
+}
+
+type ClusterRemediationSpec struct {
+	Disabled bool `json:"disabled,omitempty"`
+	//容器处于CrashLoopBackOff且重启次数达到该值时删除pod,默认5
+	CrashLoopRestartThreshold int32 `json:"crashLoopRestartThreshold,omitempty"`
+	//etcd成员持续不健康超过该时间后替换,默认5m
+	EtcdUnhealthyTimeout *metav1.Duration `json:"etcdUnhealthyTimeout,omitempty"`
+	//两次修复操作的最小间隔,默认5m
+	MinInterval *metav1.Duration `json:"minInterval,omitempty"`
+}
+
+type ClusterRetrySpec struct {
+	//模块连续失败达到该次数后不再重试,Cluster进入Failed状态,修改spec后重新开始,默认10
+	MaxAttempts int32 `json:"maxAttempts,omitempty"`
+	//首次重试的等待时间,之后每次翻倍,默认1s
+	BaseDelay *metav1.Duration `json:"baseDelay,omitempty"`
+	//重试等待时间上限,默认5m
+	MaxDelay *metav1.Duration `json:"maxDelay,omitempty"`
+}
+
+type ClusterDeletionPolicy string
+
+const (
+	//删除Cluster的所有资源
+	DeletionPolicyDelete ClusterDeletionPolicy = "Delete"
+	//保留PKI等secrets及etcd集群,其余资源随Cluster删除
+	DeletionPolicyRetain ClusterDeletionPolicy = "Retain"
+	//删除前将etcd快照保存到pvc,pvc不随Cluster删除
+	DeletionPolicySnapshot ClusterDeletionPolicy = "Snapshot"
+)
+
+type ClusterSnapshotSpec struct {
+	StorageClassName *string `json:"storageClassName,omitempty"`
+	//保存快照的pvc大小,默认1Gi
+	Size string `json:"size,omitempty"`
+}
+
+type ClusterServiceAccountSpec struct {
+	Issuer    string   `json:"issuer,omitempty"`
+	JWKSURI   string   `json:"jwksURI,omitempty"`
+	Audiences []string `json:"audiences,omitempty"`
+	//增大该值会触发一次签名密钥轮换
+	RotationGeneration int64 `json:"rotationGeneration,omitempty"`
+	//轮换后旧公钥继续有效的时间
+	GracePeriod *metav1.Duration `json:"gracePeriod,omitempty"`
+}
+
+type ClusterOIDCSpec struct {
+	IssuerURL      string `json:"issuerURL"`
+	ClientID       string `json:"clientID"`
+	UsernameClaim  string `json:"usernameClaim,omitempty"`
+	UsernamePrefix string `json:"usernamePrefix,omitempty"`
+	GroupsClaim    string `json:"groupsClaim,omitempty"`
+	GroupsPrefix   string `json:"groupsPrefix,omitempty"`
+	//签发者的CA证书,所在secret需与Cluster在同一namespace
+	CARef *corev1.SecretKeySelector `json:"caRef,omitempty"`
+}
+
+type ClusterAuthenticationWebhookSpec struct {
+	//webhook的kubeconfig,所在secret需与Cluster在同一namespace
+	KubeconfigRef corev1.SecretKeySelector `json:"kubeconfigRef"`
+	CacheTTL      string                   `json:"cacheTTL,omitempty"`
+}
+
+// 信任host集群的ServiceAccount token,通过ServiceAccountMapping映射为guest集群中的用户
+type ClusterHostServiceAccountSpec struct {
+	//必须设置该集群专用的audience,不能使用host apiserver的默认audience
+	Audiences []string `json:"audiences,omitempty"`
+}
+
+type ClusterAuthenticationSpec struct {
+	OIDC    *ClusterOIDCSpec                  `json:"oidc,omitempty"`
+	Webhook *ClusterAuthenticationWebhookSpec `json:"webhook,omitempty"`
+	//与webhook互斥
+	HostServiceAccount *ClusterHostServiceAccountSpec `json:"hostServiceAccount,omitempty"`
+}
+
 type ClusterApiServerSpec struct {
-	Count     int32 `json:"count"`
-	ImageBase `json:",inline"`
+	Count          int32 `json:"count"`
+	ImageBase      `json:",inline"`
+	Encryption     *ClusterEncryptionSpec     `json:"encryption,omitempty"`
+	Authentication *ClusterAuthenticationSpec `json:"authentication,omitempty"`
+	ServiceAccount ClusterServiceAccountSpec  `json:"serviceAccount,omitempty"`
 }
 
 type ClusterControllerManagerSpec struct {
@@ -86,6 +182,26 @@ type ClusterSpec struct {
 	ClientSpec            ClusterClientSpec            `json:"client,omitempty"`
 	KubeletSpec           ClusterKubeletSpec           `json:"kubelet,omitempty"`
 	KubeProxySpec         ClusterKubeProxySpec         `json:"kubeProxy,omitempty"`
+	//应用到apiserver,controller-manager,scheduler的特性开关,只支持kok已知的特性,已GA的特性不能关闭
+	FeatureGates map[string]bool        `json:"featureGates,omitempty"`
+	Remediation  ClusterRemediationSpec `json:"remediation,omitempty"`
+	Retry        ClusterRetrySpec       `json:"retry,omitempty"`
+	//开启后webhook拒绝删除该Cluster
+	DeletionProtection bool `json:"deletionProtection,omitempty"`
+	//Delete(默认),Retain,Snapshot
+	DeletionPolicy ClusterDeletionPolicy `json:"deletionPolicy,omitempty"`
+	//deletionPolicy为Snapshot时使用
+	Snapshot ClusterSnapshotSpec `json:"snapshot,omitempty"`
+	//集群的默认插件,由Cluster控制器创建为ClusterPlugin,移除的项会被uninstall
+	Plugins []ClusterPluginEntry `json:"plugins,omitempty"`
+}
+
+type ClusterPluginEntry struct {
+	//创建的ClusterPlugin名称为<cluster>-<name>
+	Name     string                   `json:"name"`
+	Template ClusterPluginTemplateRef `json:"template"`
+	//依赖的其他plugins项的name
+	DependsOn []string `json:"dependsOn,omitempty"`
 }
 
 type ClusterInitStatus struct {
@@ -102,6 +218,7 @@ type ClusterInitStatus struct {
 	EtcdPkiPeerName    string            `json:"etcdPkiPeerName,omitempty"`
 	EtcdPkiServerName  string            `json:"etcdPkiServerName,omitempty"`
 	EtcdPkiClientName  string            `json:"etcdPkiClientName,omitempty"`
+	FrontProxyPkiName  string            `json:"frontProxyPkiName,omitempty"`
 }
 
 type ClusterEtcdStatus struct {
@@ -110,10 +227,56 @@ type ClusterEtcdStatus struct {
 	Status  v1beta2.ClusterStatus `json:"status,omitempty"`
 }
 
+type ClusterEncryptionPhase string
+
+const (
+	EncryptionReady         ClusterEncryptionPhase = "Ready"
+	EncryptionKeyAdded      ClusterEncryptionPhase = "KeyAdded"
+	EncryptionKeyPromoted   ClusterEncryptionPhase = "KeyPromoted"
+	EncryptionRewriting     ClusterEncryptionPhase = "Rewriting"
+	EncryptionOldKeyRemoved ClusterEncryptionPhase = "OldKeyRemoved"
+)
+
+type ClusterEncryptionStatus struct {
+	SecretName       string                 `json:"secretName,omitempty"`
+	Phase            ClusterEncryptionPhase `json:"phase,omitempty"`
+	Keys             []string               `json:"keys,omitempty"`
+	ConfigHash       string                 `json:"configHash,omitempty"`
+	RolledOutHash    string                 `json:"rolledOutHash,omitempty"`
+	ObservedRotation int64                  `json:"observedRotation,omitempty"`
+	RewriteJobName   string                 `json:"rewriteJobName,omitempty"`
+	RewriteStatus    batchv1.JobStatus      `json:"rewriteStatus,omitempty"`
+}
+
+type ClusterRetiredKey struct {
+	Name           string      `json:"name"`
+	ExpirationTime metav1.Time `json:"expirationTime"`
+}
+
+type ClusterServiceAccountStatus struct {
+	SecretName       string              `json:"secretName,omitempty"`
+	ObservedRotation int64               `json:"observedRotation,omitempty"`
+	KeyHash          string              `json:"keyHash,omitempty"`
+	RetiredKeys      []ClusterRetiredKey `json:"retiredKeys,omitempty"`
+	//升级前创建的集群仍信任kubernetes-server-key签发的token,首次轮换后随宽限期失效
+	LegacyKey bool `json:"legacyKey,omitempty"`
+}
+
+type ClusterAggregationStatus struct {
+	//guest apiserver已加载front-proxy配置
+	Ready bool `json:"ready,omitempty"`
+	//metrics.k8s.io可用,kubectl top可正常使用
+	MetricsAvailable bool   `json:"metricsAvailable,omitempty"`
+	Message          string `json:"message,omitempty"`
+}
+
 type ClusterApiServerStatus struct {
-	Name    string                  `json:"name,omitempty"`
-	SvcName string                  `json:"svcName,omitempty"`
-	Status  appsv1.DeploymentStatus `json:"status,omitempty"`
+	Name           string                      `json:"name,omitempty"`
+	SvcName        string                      `json:"svcName,omitempty"`
+	Status         appsv1.DeploymentStatus     `json:"status,omitempty"`
+	Encryption     ClusterEncryptionStatus     `json:"encryption,omitempty"`
+	ServiceAccount ClusterServiceAccountStatus `json:"serviceAccount,omitempty"`
+	Aggregation    ClusterAggregationStatus    `json:"aggregation,omitempty"`
 }
 
 type ClusterControllerManagerStatus struct {
@@ -132,8 +295,61 @@ type ClusterClientStatus struct {
 }
 
 type ClusterPostInstallStatus struct {
-	Name   string            `json:"name,omitempty"`
-	Status batchv1.JobStatus `json:"status,omitempty"`
+	Name    string            `json:"name,omitempty"`
+	Status  batchv1.JobStatus `json:"status,omitempty"`
+	Retries int32             `json:"retries,omitempty"`
+}
+
+type ClusterComponentStatus struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+type ClusterGuestStatus struct {
+	Readyz            bool                     `json:"readyz,omitempty"`
+	Version           string                   `json:"version,omitempty"`
+	ComponentStatuses []ClusterComponentStatus `json:"componentStatuses,omitempty"`
+	Nodes             int32                    `json:"nodes,omitempty"`
+	ReadyNodes        int32                    `json:"readyNodes,omitempty"`
+	Namespaces        int32                    `json:"namespaces,omitempty"`
+	Pods              int32                    `json:"pods,omitempty"`
+	Message           string                   `json:"message,omitempty"`
+	LastProbeTime     *metav1.Time             `json:"lastProbeTime,omitempty"`
+}
+
+type ClusterUnhealthyMember struct {
+	Name  string      `json:"name"`
+	Since metav1.Time `json:"since"`
+}
+
+type ClusterRemediationStatus struct {
+	PodRestarts            int32                    `json:"podRestarts,omitempty"`
+	EtcdMemberReplacements int32                    `json:"etcdMemberReplacements,omitempty"`
+	JobReruns              int32                    `json:"jobReruns,omitempty"`
+	LastAction             string                   `json:"lastAction,omitempty"`
+	LastRemediationTime    *metav1.Time             `json:"lastRemediationTime,omitempty"`
+	UnhealthyEtcdMembers   []ClusterUnhealthyMember `json:"unhealthyEtcdMembers,omitempty"`
+}
+
+type ClusterModuleRetryStatus struct {
+	Module   string `json:"module"`
+	Attempts int32  `json:"attempts"`
+	//记录失败时Cluster的generation,spec变化后重置重试
+	ObservedGeneration int64        `json:"observedGeneration,omitempty"`
+	LastError          string       `json:"lastError,omitempty"`
+	LastFailureTime    *metav1.Time `json:"lastFailureTime,omitempty"`
+	//为空表示已达到最大重试次数
+	NextRetryTime *metav1.Time `json:"nextRetryTime,omitempty"`
+}
+
+type ClusterDeletionStatus struct {
+	SnapshotJobName   string            `json:"snapshotJobName,omitempty"`
+	SnapshotClaimName string            `json:"snapshotClaimName,omitempty"`
+	SnapshotStatus    batchv1.JobStatus `json:"snapshotStatus,omitempty"`
+	//正在等待删除完成的模块
+	Module         string   `json:"module,omitempty"`
+	DeletedModules []string `json:"deletedModules,omitempty"`
 }
 
 // ClusterStatus defines the observed state of Cluster
@@ -147,15 +363,40 @@ type ClusterStatus struct {
 	Scheduler         CLusterSchedulerStatus         `json:"scheduler,omitempty"`
 	Client            ClusterClientStatus            `json:"client,omitempty"`
 	PostInstall       ClusterPostInstallStatus       `json:"postInstall,omitempty"`
+	Conditions        []Condition                    `json:"conditions,omitempty"`
+	Guest             ClusterGuestStatus             `json:"guest,omitempty"`
+	Remediation       ClusterRemediationStatus       `json:"remediation,omitempty"`
+	Retries           []ClusterModuleRetryStatus     `json:"retries,omitempty"`
+	//最近一次处理的kok.tanx/reconcile-at annotation值
+	LastHandledReconcileAt string                `json:"lastHandledReconcileAt,omitempty"`
+	Deletion               ClusterDeletionStatus `json:"deletion,omitempty"`
+	//spec.plugins创建的ClusterPlugin状态,包含正在uninstall的已移除项
+	Plugins []ClusterPluginSummary `json:"plugins,omitempty"`
+}
+
+type ClusterPluginSummary struct {
+	Name          string          `json:"name"`
+	PluginName    string          `json:"pluginName"`
+	InstallStatus corev1.PodPhase `json:"installStatus,omitempty"`
+	//当前spec已install成功
+	Ready bool `json:"ready"`
+	//已从spec.plugins移除,正在uninstall
+	Removing bool `json:"removing,omitempty"`
+	//等待集群或依赖时的原因
+	Message string `json:"message,omitempty"`
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="version",type="string",JSONPath=".spec.clusterVersion",description="clusterVersion"
 // +kubebuilder:printcolumn:name="cluster-Cidr",type="string",JSONPath=".spec.clusterCidr",description="clusterCidr"
 // +kubebuilder:printcolumn:name="cluster-Dns-Addr",type="string",JSONPath=".status.init.dnsAddr",description="clusterDnsAddr"
 // +kubebuilder:printcolumn:name="service-Cluster-IpRange",type="string",JSONPath=".spec.serviceClusterIpRange",description="serviceClusterIpRange"
 // +kubebuilder:printcolumn:name="access-address",type="string",JSONPath=".spec.access.address",description="access-address"
 // +kubebuilder:printcolumn:name="access-port",type="string",JSONPath=".spec.access.port",description="access-port"
+// +kubebuilder:printcolumn:name="guest-version",type="string",JSONPath=".status.guest.version",description="guest-version"
+// +kubebuilder:printcolumn:name="nodes",type="integer",JSONPath=".status.guest.nodes",description="nodes"
+// +kubebuilder:printcolumn:name="ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description="ready"
 
 // Cluster is the Schema for the clusters API
 type Cluster struct {
@@ -17,7 +17,9 @@ limitations under the License.
 package v1
 
 import (
+	"fmt"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -114,6 +116,9 @@ func (r *Cluster) Default() {
 	for _, defaulter := range defaulters {
 		defaulter.Default(r)
 	}
+	if r.Spec.DeletionPolicy == "" {
+		r.Spec.DeletionPolicy = DeletionPolicyDelete
+	}
 }
 
 func getVersion(version string) string {
@@ -123,14 +128,15 @@ func getVersion(version string) string {
 	return maxVersion
 }
 
-// +kubebuilder:webhook:verbs=create;update,path=/validate-cluster-kok-tanx-v1-cluster,mutating=false,failurePolicy=fail,groups=cluster.kok.tanx,resources=clusters,versions=v1,name=vcluster.kb.io
+// +kubebuilder:webhook:verbs=create;update;delete,path=/validate-cluster-kok-tanx-v1-cluster,mutating=false,failurePolicy=fail,groups=cluster.kok.tanx,resources=clusters,versions=v1,name=vcluster.kb.io
 
 var _ webhook.Validator = &Cluster{}
 
 // ValidateCreate implements webhook.Validator so a webhook will be registered for the type
 func (r *Cluster) ValidateCreate() error {
 	clusterlog.Info("validate create", "name", r.Name)
-	var allErrs field.ErrorList
+	allErrs := validateDeletion(r)
+	allErrs = append(allErrs, validatePlugins(r)...)
 
 	validators := VersionedValidators[r.Spec.ClusterVersion]
 	for _, v := range validators {
@@ -148,12 +154,13 @@ func (r *Cluster) ValidateCreate() error {
 func (r *Cluster) ValidateUpdate(old runtime.Object) error {
 	clusterlog.Info("validate update", "name", r.Name)
 	oldC := old.(*Cluster)
-	var allErrs field.ErrorList
+	allErrs := validateDeletion(r)
+	allErrs = append(allErrs, validatePlugins(r)...)
 
 	validators := VersionedValidators[r.Spec.ClusterVersion]
 	for _, v := range validators {
 
-		allErrs = append(allErrs, v.ValidateUpdate(oldC, r)...)
+		allErrs = append(allErrs, v.ValidateUpdate(r, oldC)...)
 	}
 
 	if len(allErrs) == 0 {
@@ -166,5 +173,49 @@ func (r *Cluster) ValidateUpdate(old runtime.Object) error {
 func (r *Cluster) ValidateDelete() error {
 	clusterlog.Info("validate delete", "name", r.Name)
 
+	if r.Spec.DeletionProtection {
+		return errors.NewForbidden(GroupVersion.WithResource("clusters").GroupResource(), r.Name,
+			fmt.Errorf("spec.deletionProtection is enabled"))
+	}
 	return nil
 }
+
+func validateDeletion(r *Cluster) field.ErrorList {
+	var allErrs field.ErrorList
+	switch r.Spec.DeletionPolicy {
+	case "", DeletionPolicyDelete, DeletionPolicyRetain, DeletionPolicySnapshot:
+	default:
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec.deletionPolicy"), r.Spec.DeletionPolicy, "只支持Delete,Retain,Snapshot"))
+	}
+	if size := r.Spec.Snapshot.Size; size != "" {
+		if _, err := resource.ParseQuantity(size); err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec.snapshot.size"), size, err.Error()))
+		}
+	}
+	return allErrs
+}
+
+func validatePlugins(r *Cluster) field.ErrorList {
+	var allErrs field.ErrorList
+	names := map[string]bool{}
+	for i, p := range r.Spec.Plugins {
+		path := field.NewPath("spec", "plugins").Index(i)
+		if p.Name == "" {
+			allErrs = append(allErrs, field.Required(path.Child("name"), ""))
+		} else if names[p.Name] {
+			allErrs = append(allErrs, field.Duplicate(path.Child("name"), p.Name))
+		}
+		names[p.Name] = true
+		if p.Template.Name == "" {
+			allErrs = append(allErrs, field.Required(path.Child("template", "name"), ""))
+		}
+	}
+	for i, p := range r.Spec.Plugins {
+		for j, dep := range p.DependsOn {
+			if !names[dep] || dep == p.Name {
+				allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "plugins").Index(i).Child("dependsOn").Index(j), dep, "必须是spec.plugins中的其他项"))
+			}
+		}
+	}
+	return allErrs
+}
@@ -0,0 +1,33 @@
+package v1
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// recordValidator 记录ValidateUpdate收到的参数
+type recordValidator struct {
+	now, old *Cluster
+}
+
+func (v *recordValidator) ValidateCreate(c *Cluster) field.ErrorList {
+	return nil
+}
+
+func (v *recordValidator) ValidateUpdate(now *Cluster, old *Cluster) field.ErrorList {
+	v.now, v.old = now, old
+	return nil
+}
+
+func TestClusterValidateUpdateOrder(t *testing.T) {
+	v := &recordValidator{}
+	RegisterVersionedValidators("validate-order", v)
+	old := &Cluster{Spec: ClusterSpec{ClusterVersion: "validate-order"}}
+	now := old.DeepCopy()
+	now.Spec.ApiServerSpec.ServiceAccount.RotationGeneration = 1
+	_ = now.ValidateUpdate(old)
+	if v.now != now || v.old != old {
+		t.Errorf("ValidateUpdate called with (%p, %p), want (%p, %p)", v.now, v.old, now, old)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterCredentialSpec defines the desired state of ClusterCredential
+type ClusterCredentialSpec struct {
+	ClusterName string `json:"clusterName"`
+	// +kubebuilder:validation:MinLength=1
+	Username string   `json:"username"`
+	Groups   []string `json:"groups,omitempty"`
+	//证书有效期,默认24h
+	TTL metav1.Duration `json:"ttl,omitempty"`
+	//允许签发system:开头的用户名或组(如system:masters),默认拒绝
+	AllowSystemIdentity bool `json:"allowSystemIdentity,omitempty"`
+}
+
+type ClusterCredentialPhase string
+
+const (
+	CredentialPending ClusterCredentialPhase = "Pending"
+	CredentialIssued  ClusterCredentialPhase = "Issued"
+	CredentialExpired ClusterCredentialPhase = "Expired"
+)
+
+type IssuedCredential struct {
+	SerialNumber string      `json:"serialNumber"`
+	SecretName   string      `json:"secretName"`
+	Username     string      `json:"username"`
+	Groups       []string    `json:"groups,omitempty"`
+	NotBefore    metav1.Time `json:"notBefore"`
+	NotAfter     metav1.Time `json:"notAfter"`
+}
+
+// ClusterCredentialStatus defines the observed state of ClusterCredential
+type ClusterCredentialStatus struct {
+	Phase          ClusterCredentialPhase `json:"phase,omitempty"`
+	SecretName     string                 `json:"secretName,omitempty"`
+	ExpirationTime *metav1.Time           `json:"expirationTime,omitempty"`
+	Message        string                 `json:"message,omitempty"`
+	Issued         []IssuedCredential     `json:"issued,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="cluster",type="string",JSONPath=".spec.clusterName",description="cluster_name"
+// +kubebuilder:printcolumn:name="username",type="string",JSONPath=".spec.username",description="username"
+// +kubebuilder:printcolumn:name="phase",type="string",JSONPath=".status.phase",description="phase"
+// +kubebuilder:printcolumn:name="secret",type="string",JSONPath=".status.secretName",description="kubeconfig_secret"
+// +kubebuilder:printcolumn:name="expiration",type="string",JSONPath=".status.expirationTime",description="expiration_time"
+
+// ClusterCredential is the Schema for the clustercredentials API
+type ClusterCredential struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterCredentialSpec   `json:"spec,omitempty"`
+	Status ClusterCredentialStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterCredentialList contains a list of ClusterCredential
+type ClusterCredentialList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterCredential `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterCredential{}, &ClusterCredentialList{})
+}
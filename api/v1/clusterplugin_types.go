@@ -74,7 +74,7 @@ type ClusterPluginPodSpec struct {
 	InitContainers []ClusterPluginPodContainer `json:"initContainers,omitempty" patchStrategy:"merge" patchMergeKey:"name" protobuf:"bytes,20,rep,name=initContainers"`
 	// +patchMergeKey=name
 	// +patchStrategy=merge
-	Containers []ClusterPluginPodContainer `json:"containers" patchStrategy:"merge" patchMergeKey:"name" protobuf:"bytes,2,rep,name=containers"`
+	Containers []ClusterPluginPodContainer `json:"containers,omitempty" patchStrategy:"merge" patchMergeKey:"name" protobuf:"bytes,2,rep,name=containers"`
 
 	// +optional
 	ServiceAccountName string `json:"serviceAccountName,omitempty" protobuf:"bytes,8,opt,name=serviceAccountName"`
@@ -86,28 +86,163 @@ type ClusterPluginPodSpec struct {
 	Hostname string `json:"hostname,omitempty" protobuf:"bytes,16,opt,name=hostname"`
 	// +optional
 	RuntimeClassName *string `json:"runtimeClassName,omitempty" protobuf:"bytes,29,opt,name=runtimeClassName"`
+	//完整的pod模板,设置时忽略以上字段,kubeconfig卷由kok注入.
+	//不生成schema,避免CRD超出大小限制
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Type=object
+	PodTemplate *v1.PodTemplateSpec `json:"podTemplate,omitempty"`
+}
+
+// IsEmpty 没有需要运行的容器
+func (in ClusterPluginPodSpec) IsEmpty() bool {
+	if in.PodTemplate != nil {
+		return len(in.PodTemplate.Spec.Containers) == 0
+	}
+	return len(in.Containers) == 0
+}
+
+type ClusterReadinessPolicy string
+
+const (
+	//Cluster的Ready condition为True
+	ClusterReadinessReady ClusterReadinessPolicy = "Ready"
+	//Cluster的admin kubeconfig已生成
+	ClusterReadinessInitialized ClusterReadinessPolicy = "Initialized"
+	//不等待Cluster就绪,job仍需admin kubeconfig
+	ClusterReadinessNone ClusterReadinessPolicy = "None"
+)
+
+// ClusterPluginReference 引用同namespace下的插件
+type ClusterPluginReference struct {
+	//ClusterPlugin或MultiClusterPlugin,默认ClusterPlugin
+	// +kubebuilder:validation:Enum=ClusterPlugin;MultiClusterPlugin
+	Kind string `json:"kind,omitempty"`
+	Name string `json:"name"`
 }
 
 type CLusterPluginSpecInner struct {
 	Install   ClusterPluginPodSpec `json:"install,omitempty"`
 	Uninstall ClusterPluginPodSpec `json:"uninstall,omitempty"`
+	//install,uninstall job失败后的重试次数,默认3
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+	//install,uninstall job的最长运行时间,默认600
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+	//job结束后保留的时间,为空时不自动清理
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+	//运行插件前集群需满足的就绪条件,默认Ready
+	// +kubebuilder:validation:Enum=Ready;Initialized;None
+	ClusterReadiness ClusterReadinessPolicy `json:"clusterReadiness,omitempty"`
+	//依赖的插件,需覆盖本插件的所有集群,全部install成功后才开始install,删除时在依赖于本插件的插件之后uninstall
+	DependsOn []ClusterPluginReference `json:"dependsOn,omitempty"`
+}
+
+type TemplateUpdatePolicy string
+
+const (
+	//模板或values变化后重新渲染
+	TemplateUpdatePolicyAuto TemplateUpdatePolicy = "Auto"
+	//只在values变化时按最新模板重新渲染,install,uninstall被直接修改时按上次渲染的内容恢复
+	TemplateUpdatePolicyManual TemplateUpdatePolicy = "Manual"
+)
+
+type ClusterPluginTemplateRef struct {
+	//同namespace下的ClusterPluginTemplate
+	Name   string            `json:"name"`
+	Values map[string]string `json:"values,omitempty"`
+	//默认Auto
+	// +kubebuilder:validation:Enum=Auto;Manual
+	UpdatePolicy TemplateUpdatePolicy `json:"updatePolicy,omitempty"`
 }
 
 // ClusterPluginSpec defines the desired state of ClusterPlugin
 type ClusterPluginSpec struct {
 	CLusterPluginSpecInner `json:",inline"`
 	ClusterName            string `json:"clusterName"`
+	//设置后install,uninstall等由模板渲染,覆盖spec中的对应字段
+	Template *ClusterPluginTemplateRef `json:"template,omitempty"`
 }
 
 type ClusterPluginPodStatus struct {
-	PodName string      `json:"podName,omitempty"`
+	JobName string      `json:"jobName,omitempty"`
 	Status  v1.PodPhase `json:"status,omitempty"`
+	//本次运行使用的spec的hash
+	SpecHash string `json:"specHash,omitempty"`
+	//已运行的pod数,包含正在运行的
+	Attempts           int32        `json:"attempts,omitempty"`
+	Failed             int32        `json:"failed,omitempty"`
+	LastFailureReason  string       `json:"lastFailureReason,omitempty"`
+	LastFailureMessage string       `json:"lastFailureMessage,omitempty"`
+	LastFailureTime    *metav1.Time `json:"lastFailureTime,omitempty"`
+	StartTime          *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime     *metav1.Time `json:"completionTime,omitempty"`
 }
 
 // ClusterPluginStatus defines the observed state of ClusterPlugin
 type ClusterPluginStatus struct {
 	InstallStatus   ClusterPluginPodStatus `json:"installStatus,omitempty"`
 	UninstallStatus ClusterPluginPodStatus `json:"uninstallStatus,omitempty"`
+	//当前spec的install已成功运行时更新为对象的generation
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	//之前的install运行记录,最新的在最后
+	History    []ClusterPluginPodStatus `json:"history,omitempty"`
+	Conditions []Condition              `json:"conditions,omitempty"`
+	//最近一次渲染使用的模板
+	Template ClusterPluginTemplateStatus `json:"template,omitempty"`
+	//MultiClusterPlugin的目标集群
+	Clusters []ClusterPluginClusterStatus `json:"clusters,omitempty"`
+	//PerCluster模式下各集群install的汇总
+	Summary *ClusterPluginRunSummary `json:"summary,omitempty"`
+	//MultiClusterPlugin spec.rolloutStrategy的发布进度
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+}
+
+type ClusterPluginClusterStatus struct {
+	Name string `json:"name"`
+	//集群不再匹配,正在对该集群单独uninstall
+	Removing bool `json:"removing,omitempty"`
+	//PerCluster模式下该集群的install
+	InstallStatus   ClusterPluginPodStatus `json:"installStatus,omitempty"`
+	UninstallStatus ClusterPluginPodStatus `json:"uninstallStatus,omitempty"`
+	//最近一次运行的pod
+	PodName string `json:"podName,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type ClusterPluginRunSummary struct {
+	Total     int32 `json:"total"`
+	Installed int32 `json:"installed"`
+	Failed    int32 `json:"failed"`
+	Pending   int32 `json:"pending"`
+}
+
+type RolloutPhase string
+
+const (
+	RolloutPhaseCanary              RolloutPhase = "Canary"
+	RolloutPhaseWaitingForPromotion RolloutPhase = "WaitingForPromotion"
+	RolloutPhaseProgressing         RolloutPhase = "Progressing"
+	RolloutPhasePaused              RolloutPhase = "Paused"
+	RolloutPhaseCompleted           RolloutPhase = "Completed"
+)
+
+type RolloutStatus struct {
+	//install spec的hash前8位,与install job名称后缀一致
+	Revision string       `json:"revision,omitempty"`
+	Phase    RolloutPhase `json:"phase,omitempty"`
+	Message  string       `json:"message,omitempty"`
+	//已处理的annotation kok.tanx/rollout-retry的值
+	LastHandledRetry string `json:"lastHandledRetry,omitempty"`
+}
+
+type ClusterPluginTemplateStatus struct {
+	Name       string `json:"name,omitempty"`
+	Generation int64  `json:"generation,omitempty"`
+	ValuesHash string `json:"valuesHash,omitempty"`
+	//渲染后install,uninstall的hash,与spec不一致说明被直接修改,需要重新渲染
+	SpecHash string `json:"specHash,omitempty"`
+	//最近一次渲染的install,uninstall(json),Manual时直接修改的内容按此恢复,不引入未确认的模板变化
+	Rendered string `json:"rendered,omitempty"`
 }
 
 func (in *ClusterPlugin) GetSpec() CLusterPluginSpecInner {
@@ -127,10 +262,11 @@ func (in *ClusterPlugin) UpdateStatus(target ClusterPluginStatus) {
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="cluster",type="string",JSONPath=".spec.clusterName",description="cluster_name"
-// +kubebuilder:printcolumn:name="install-pod",type="string",JSONPath=".status.installStatus.podName",description="install-pod_name"
+// +kubebuilder:printcolumn:name="install-job",type="string",JSONPath=".status.installStatus.jobName",description="install-job_name"
 // +kubebuilder:printcolumn:name="install-ready",type="string",JSONPath=".status.installStatus.status",description="install-ready"
-// +kubebuilder:printcolumn:name="uninstall-pod",type="string",JSONPath=".status.installStatus.podName",description="uninstall-pod_name"
+// +kubebuilder:printcolumn:name="uninstall-job",type="string",JSONPath=".status.uninstallStatus.jobName",description="uninstall-job_name"
 // +kubebuilder:printcolumn:name="uninstall-ready",type="string",JSONPath=".status.uninstallStatus.status",description="uninstall-ready"
 
 // ClusterPlugin is the Schema for the clusterplugins API
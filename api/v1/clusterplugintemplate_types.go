@@ -0,0 +1,143 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"strconv"
+	"strings"
+)
+
+type ClusterPluginTemplateParameterType string
+
+const (
+	ParameterTypeString  ClusterPluginTemplateParameterType = "string"
+	ParameterTypeInteger ClusterPluginTemplateParameterType = "integer"
+	ParameterTypeBoolean ClusterPluginTemplateParameterType = "boolean"
+)
+
+type ClusterPluginTemplateParameter struct {
+	//在模板中以$(params.<name>)引用
+	Name string `json:"name"`
+	//默认string
+	// +kubebuilder:validation:Enum=string;integer;boolean
+	Type        ClusterPluginTemplateParameterType `json:"type,omitempty"`
+	Description string                             `json:"description,omitempty"`
+	//未设置默认值的参数必须在ClusterPlugin中指定
+	Default *string `json:"default,omitempty"`
+}
+
+// ClusterPluginTemplateSpec defines the desired state of ClusterPluginTemplate
+type ClusterPluginTemplateSpec struct {
+	Parameters []ClusterPluginTemplateParameter `json:"parameters,omitempty"`
+	Template   CLusterPluginSpecInner           `json:"template"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterPluginTemplate is the Schema for the clusterplugintemplates API
+type ClusterPluginTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ClusterPluginTemplateSpec `json:"spec,omitempty"`
+}
+
+// ValidateValues 按参数定义校验ClusterPlugin中指定的values
+func (in *ClusterPluginTemplate) ValidateValues(values map[string]string, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	defined := map[string]bool{}
+	for _, p := range in.Spec.Parameters {
+		defined[p.Name] = true
+		value, ok := values[p.Name]
+		if !ok {
+			if p.Default == nil {
+				errs = append(errs, field.Required(path.Key(p.Name), fmt.Sprintf("template %s requires parameter %s", in.Name, p.Name)))
+			}
+			continue
+		}
+		if err := validateParameterValue(p.Type, value); err != nil {
+			errs = append(errs, field.Invalid(path.Key(p.Name), value, err.Error()))
+		}
+	}
+	for name := range values {
+		if !defined[name] {
+			errs = append(errs, field.NotSupported(path.Key(name), name, parameterNames(in.Spec.Parameters)))
+		}
+	}
+	return errs
+}
+
+// Render 使用values(未指定时使用默认值)替换模板中的$(params.<name>)
+func (in *ClusterPluginTemplate) Render(values map[string]string) (CLusterPluginSpecInner, error) {
+	spec := CLusterPluginSpecInner{}
+	if errs := in.ValidateValues(values, field.NewPath("values")); len(errs) > 0 {
+		return spec, errs.ToAggregate()
+	}
+	data, err := json.Marshal(in.Spec.Template)
+	if err != nil {
+		return spec, err
+	}
+	rendered := string(data)
+	for _, p := range in.Spec.Parameters {
+		value, ok := values[p.Name]
+		if !ok {
+			value = *p.Default
+		}
+		//按json字符串转义,避免value中的引号等破坏结构
+		escaped, _ := json.Marshal(value)
+		rendered = strings.ReplaceAll(rendered, "$(params."+p.Name+")", strings.Trim(string(escaped), `"`))
+	}
+	err = json.Unmarshal([]byte(rendered), &spec)
+	return spec, err
+}
+
+func validateParameterValue(t ClusterPluginTemplateParameterType, value string) error {
+	switch t {
+	case ParameterTypeInteger:
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err
+	case ParameterTypeBoolean:
+		_, err := strconv.ParseBool(value)
+		return err
+	}
+	return nil
+}
+
+func parameterNames(params []ClusterPluginTemplateParameter) []string {
+	names := make([]string, len(params))
+	for i, p := range params {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterPluginTemplateList contains a list of ClusterPluginTemplate
+type ClusterPluginTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterPluginTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterPluginTemplate{}, &ClusterPluginTemplateList{})
+}
@@ -0,0 +1,75 @@
+package v1
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func testTemplate() *ClusterPluginTemplate {
+	version := "v1"
+	t := &ClusterPluginTemplate{}
+	t.Name = "tmpl"
+	t.Spec.Parameters = []ClusterPluginTemplateParameter{
+		{Name: "version", Default: &version},
+		{Name: "replicas", Type: ParameterTypeInteger},
+		{Name: "debug", Type: ParameterTypeBoolean, Default: &version},
+	}
+	t.Spec.Template.Install.Containers = []ClusterPluginPodContainer{{
+		Name:  "install",
+		Image: "plugin:$(params.version)",
+		Args:  []string{"--replicas=$(params.replicas)", "$(params.version)"},
+	}}
+	return t
+}
+
+func TestClusterPluginTemplateValidateValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]string
+		fields []string
+	}{
+		{name: "valid", values: map[string]string{"replicas": "3", "debug": "true"}},
+		{name: "missing required", values: map[string]string{}, fields: []string{"values[replicas]"}},
+		{name: "invalid integer", values: map[string]string{"replicas": "three"}, fields: []string{"values[replicas]"}},
+		{name: "invalid boolean", values: map[string]string{"replicas": "1", "debug": "maybe"}, fields: []string{"values[debug]"}},
+		{name: "unknown parameter", values: map[string]string{"replicas": "1", "other": "x"}, fields: []string{"values[other]"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []string
+			for _, err := range testTemplate().ValidateValues(tt.values, field.NewPath("values")) {
+				fields = append(fields, err.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("ValidateValues() fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestClusterPluginTemplateRender(t *testing.T) {
+	tmpl := testTemplate()
+	spec, err := tmpl.Render(map[string]string{"replicas": "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := spec.Install.Containers[0]
+	if c.Image != "plugin:v1" || !reflect.DeepEqual(c.Args, []string{"--replicas=3", "v1"}) {
+		t.Errorf("Render() container = %+v", c)
+	}
+	if tmpl.Spec.Template.Install.Containers[0].Image != "plugin:$(params.version)" {
+		t.Error("Render() modified the template")
+	}
+
+	//value中的引号不能破坏json结构
+	spec, err = tmpl.Render(map[string]string{"replicas": "1", "version": `a"b`})
+	if err != nil || spec.Install.Containers[0].Image != `plugin:a"b` {
+		t.Errorf("Render() with quote = %v, %v", spec.Install.Containers[0].Image, err)
+	}
+
+	if _, err := tmpl.Render(nil); err == nil {
+		t.Error("Render() without required value succeeded")
+	}
+}
@@ -0,0 +1,83 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type ConditionType string
+
+const (
+	//集群所有模块就绪,且guest apiserver /readyz检查通过
+	ConditionReady ConditionType = "Ready"
+	//模块连续失败达到最大重试次数,不再自动重试;删除时etcd快照失败
+	ConditionFailed ConditionType = "Failed"
+	//Cluster带有kok.tanx/paused annotation,暂停调谐
+	ConditionPaused ConditionType = "Paused"
+	//插件等待目标集群满足spec.clusterReadiness
+	ConditionWaitingForCluster ConditionType = "WaitingForCluster"
+	//插件等待依赖的插件install成功,或删除时等待依赖于它的插件uninstall
+	ConditionWaitingForDependencies ConditionType = "WaitingForDependencies"
+)
+
+type Condition struct {
+	Type               ConditionType          `json:"type"`
+	Status             corev1.ConditionStatus `json:"status"`
+	Reason             string                 `json:"reason,omitempty"`
+	Message            string                 `json:"message,omitempty"`
+	LastTransitionTime metav1.Time            `json:"lastTransitionTime,omitempty"`
+}
+
+// SetCondition 更新或新增condition,只有status变化时才更新LastTransitionTime
+func SetCondition(conditions *[]Condition, t ConditionType, status corev1.ConditionStatus, reason, message string) {
+	for i := range *conditions {
+		c := &(*conditions)[i]
+		if c.Type != t {
+			continue
+		}
+		if c.Status != status {
+			c.LastTransitionTime = metav1.Now()
+		}
+		c.Status = status
+		c.Reason = reason
+		c.Message = message
+		return
+	}
+	*conditions = append(*conditions, Condition{
+		Type:               t,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: metav1.Now(),
+	})
+}
+
+func GetCondition(conditions []Condition, t ConditionType) *Condition {
+	for i := range conditions {
+		if conditions[i].Type == t {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+func IsConditionTrue(conditions []Condition, t ConditionType) bool {
+	c := GetCondition(conditions, t)
+	return c != nil && c.Status == corev1.ConditionTrue
+}
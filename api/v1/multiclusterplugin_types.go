@@ -25,9 +25,40 @@ import (
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+type ExecutionMode string
+
+const (
+	//一个job挂载所有目标集群的kubeconfig
+	ExecutionModeSingle ExecutionMode = "Single"
+	//每个目标集群单独运行install,uninstall job
+	ExecutionModePerCluster ExecutionMode = "PerCluster"
+)
+
+// 发布时先在canary集群install,全部成功后(manualPromotion时需要promote)按maxConcurrent继续其他集群,
+// 当前revision失败的集群数达到maxFailures时暂停,修正spec后以新的revision重新发布,
+// 或修改annotation kok.tanx/rollout-retry的值在失败的集群上重新install.仅PerCluster模式可设置
+type RolloutStrategy struct {
+	//同时运行install的集群数,默认不限制
+	// +kubebuilder:validation:Minimum=1
+	MaxConcurrent *int32 `json:"maxConcurrent,omitempty"`
+	//优先install的集群
+	Canary []string `json:"canary,omitempty"`
+	//默认1
+	// +kubebuilder:validation:Minimum=1
+	MaxFailures *int32 `json:"maxFailures,omitempty"`
+	//canary成功后等待annotation kok.tanx/rollout-promote=<status.rollout.revision>
+	ManualPromotion bool `json:"manualPromotion,omitempty"`
+}
+
 // MultiClusterPluginSpec defines the desired state of MultiClusterPlugin
 type MultiClusterPluginSpec struct {
-	Clusters               []string `json:"clusters"`
+	Clusters []string `json:"clusters,omitempty"`
+	//按label选择同namespace下的Cluster,与clusters合并
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+	//默认Single
+	// +kubebuilder:validation:Enum=Single;PerCluster
+	ExecutionMode          ExecutionMode    `json:"executionMode,omitempty"`
+	RolloutStrategy        *RolloutStrategy `json:"rolloutStrategy,omitempty"`
 	CLusterPluginSpecInner `json:",inline"`
 }
 
@@ -44,6 +75,7 @@ type ClusterPluginObj interface {
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
 
 // MultiClusterPlugin is the Schema for the multiclusterplugins API
 type MultiClusterPlugin struct {
@@ -62,8 +94,18 @@ func (in *MultiClusterPlugin) GetStatus() ClusterPluginStatus {
 	return in.Status
 }
 
+// GetClusterNames 返回status中解析出的目标集群(不含正在移除的),未解析时返回spec.clusters
 func (in *MultiClusterPlugin) GetClusterNames() string {
-	return strings.Join(in.Spec.Clusters, ",")
+	if len(in.Status.Clusters) == 0 {
+		return strings.Join(in.Spec.Clusters, ",")
+	}
+	var names []string
+	for _, c := range in.Status.Clusters {
+		if !c.Removing {
+			names = append(names, c.Name)
+		}
+	}
+	return strings.Join(names, ",")
 }
 
 func (in *MultiClusterPlugin) UpdateStatus(target ClusterPluginStatus) {
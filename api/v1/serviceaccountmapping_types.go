@@ -0,0 +1,63 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type ServiceAccountReference struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// ServiceAccountMappingSpec defines the desired state of ServiceAccountMapping
+type ServiceAccountMappingSpec struct {
+	ClusterName string `json:"clusterName"`
+	//host集群中的ServiceAccount
+	ServiceAccount ServiceAccountReference `json:"serviceAccount"`
+	//在guest集群中使用的用户名和组
+	Username string   `json:"username"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="cluster",type="string",JSONPath=".spec.clusterName",description="cluster_name"
+// +kubebuilder:printcolumn:name="sa-namespace",type="string",JSONPath=".spec.serviceAccount.namespace",description="serviceaccount_namespace"
+// +kubebuilder:printcolumn:name="sa-name",type="string",JSONPath=".spec.serviceAccount.name",description="serviceaccount_name"
+// +kubebuilder:printcolumn:name="username",type="string",JSONPath=".spec.username",description="guest_username"
+
+// ServiceAccountMapping is the Schema for the serviceaccountmappings API
+type ServiceAccountMapping struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ServiceAccountMappingSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ServiceAccountMappingList contains a list of ServiceAccountMapping
+type ServiceAccountMappingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ServiceAccountMapping `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ServiceAccountMapping{}, &ServiceAccountMappingList{})
+}
@@ -22,6 +22,7 @@ package v1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -30,6 +31,26 @@ func (in *CLusterPluginSpecInner) DeepCopyInto(out *CLusterPluginSpecInner) {
 	*out = *in
 	in.Install.DeepCopyInto(&out.Install)
 	in.Uninstall.DeepCopyInto(&out.Uninstall)
+	if in.BackoffLimit != nil {
+		in, out := &in.BackoffLimit, &out.BackoffLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ActiveDeadlineSeconds != nil {
+		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.TTLSecondsAfterFinished != nil {
+		in, out := &in.TTLSecondsAfterFinished, &out.TTLSecondsAfterFinished
+		*out = new(int32)
+		**out = **in
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]ClusterPluginReference, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CLusterPluginSpecInner.
@@ -100,10 +121,36 @@ func (in *ClusterAccessSpec) DeepCopy() *ClusterAccessSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterAggregationStatus) DeepCopyInto(out *ClusterAggregationStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAggregationStatus.
+func (in *ClusterAggregationStatus) DeepCopy() *ClusterAggregationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterAggregationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterApiServerSpec) DeepCopyInto(out *ClusterApiServerSpec) {
 	*out = *in
 	out.ImageBase = in.ImageBase
+	if in.Encryption != nil {
+		in, out := &in.Encryption, &out.Encryption
+		*out = new(ClusterEncryptionSpec)
+		**out = **in
+	}
+	if in.Authentication != nil {
+		in, out := &in.Authentication, &out.Authentication
+		*out = new(ClusterAuthenticationSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	in.ServiceAccount.DeepCopyInto(&out.ServiceAccount)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterApiServerSpec.
@@ -120,6 +167,9 @@ func (in *ClusterApiServerSpec) DeepCopy() *ClusterApiServerSpec {
 func (in *ClusterApiServerStatus) DeepCopyInto(out *ClusterApiServerStatus) {
 	*out = *in
 	in.Status.DeepCopyInto(&out.Status)
+	in.Encryption.DeepCopyInto(&out.Encryption)
+	in.ServiceAccount.DeepCopyInto(&out.ServiceAccount)
+	out.Aggregation = in.Aggregation
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterApiServerStatus.
@@ -132,6 +182,52 @@ func (in *ClusterApiServerStatus) DeepCopy() *ClusterApiServerStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterAuthenticationSpec) DeepCopyInto(out *ClusterAuthenticationSpec) {
+	*out = *in
+	if in.OIDC != nil {
+		in, out := &in.OIDC, &out.OIDC
+		*out = new(ClusterOIDCSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Webhook != nil {
+		in, out := &in.Webhook, &out.Webhook
+		*out = new(ClusterAuthenticationWebhookSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HostServiceAccount != nil {
+		in, out := &in.HostServiceAccount, &out.HostServiceAccount
+		*out = new(ClusterHostServiceAccountSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAuthenticationSpec.
+func (in *ClusterAuthenticationSpec) DeepCopy() *ClusterAuthenticationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterAuthenticationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterAuthenticationWebhookSpec) DeepCopyInto(out *ClusterAuthenticationWebhookSpec) {
+	*out = *in
+	in.KubeconfigRef.DeepCopyInto(&out.KubeconfigRef)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAuthenticationWebhookSpec.
+func (in *ClusterAuthenticationWebhookSpec) DeepCopy() *ClusterAuthenticationWebhookSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterAuthenticationWebhookSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterClientSpec) DeepCopyInto(out *ClusterClientSpec) {
 	*out = *in
@@ -164,6 +260,21 @@ func (in *ClusterClientStatus) DeepCopy() *ClusterClientStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterComponentStatus) DeepCopyInto(out *ClusterComponentStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterComponentStatus.
+func (in *ClusterComponentStatus) DeepCopy() *ClusterComponentStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterComponentStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterControllerManagerSpec) DeepCopyInto(out *ClusterControllerManagerSpec) {
 	*out = *in
@@ -196,6 +307,169 @@ func (in *ClusterControllerManagerStatus) DeepCopy() *ClusterControllerManagerSt
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterCredential) DeepCopyInto(out *ClusterCredential) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCredential.
+func (in *ClusterCredential) DeepCopy() *ClusterCredential {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterCredential)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterCredential) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterCredentialList) DeepCopyInto(out *ClusterCredentialList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterCredential, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCredentialList.
+func (in *ClusterCredentialList) DeepCopy() *ClusterCredentialList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterCredentialList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterCredentialList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterCredentialSpec) DeepCopyInto(out *ClusterCredentialSpec) {
+	*out = *in
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	out.TTL = in.TTL
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCredentialSpec.
+func (in *ClusterCredentialSpec) DeepCopy() *ClusterCredentialSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterCredentialSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterCredentialStatus) DeepCopyInto(out *ClusterCredentialStatus) {
+	*out = *in
+	if in.ExpirationTime != nil {
+		in, out := &in.ExpirationTime, &out.ExpirationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Issued != nil {
+		in, out := &in.Issued, &out.Issued
+		*out = make([]IssuedCredential, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCredentialStatus.
+func (in *ClusterCredentialStatus) DeepCopy() *ClusterCredentialStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterCredentialStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterDeletionStatus) DeepCopyInto(out *ClusterDeletionStatus) {
+	*out = *in
+	in.SnapshotStatus.DeepCopyInto(&out.SnapshotStatus)
+	if in.DeletedModules != nil {
+		in, out := &in.DeletedModules, &out.DeletedModules
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterDeletionStatus.
+func (in *ClusterDeletionStatus) DeepCopy() *ClusterDeletionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterDeletionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterEncryptionSpec) DeepCopyInto(out *ClusterEncryptionSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterEncryptionSpec.
+func (in *ClusterEncryptionSpec) DeepCopy() *ClusterEncryptionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterEncryptionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterEncryptionStatus) DeepCopyInto(out *ClusterEncryptionStatus) {
+	*out = *in
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.RewriteStatus.DeepCopyInto(&out.RewriteStatus)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterEncryptionStatus.
+func (in *ClusterEncryptionStatus) DeepCopy() *ClusterEncryptionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterEncryptionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterEtcdSpec) DeepCopyInto(out *ClusterEtcdSpec) {
 	*out = *in
@@ -227,6 +501,50 @@ func (in *ClusterEtcdStatus) DeepCopy() *ClusterEtcdStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterGuestStatus) DeepCopyInto(out *ClusterGuestStatus) {
+	*out = *in
+	if in.ComponentStatuses != nil {
+		in, out := &in.ComponentStatuses, &out.ComponentStatuses
+		*out = make([]ClusterComponentStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastProbeTime != nil {
+		in, out := &in.LastProbeTime, &out.LastProbeTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGuestStatus.
+func (in *ClusterGuestStatus) DeepCopy() *ClusterGuestStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterGuestStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterHostServiceAccountSpec) DeepCopyInto(out *ClusterHostServiceAccountSpec) {
+	*out = *in
+	if in.Audiences != nil {
+		in, out := &in.Audiences, &out.Audiences
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterHostServiceAccountSpec.
+func (in *ClusterHostServiceAccountSpec) DeepCopy() *ClusterHostServiceAccountSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterHostServiceAccountSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterInitSpec) DeepCopyInto(out *ClusterInitSpec) {
 	*out = *in
@@ -321,13 +639,56 @@ func (in *ClusterList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterModuleRetryStatus) DeepCopyInto(out *ClusterModuleRetryStatus) {
+	*out = *in
+	if in.LastFailureTime != nil {
+		in, out := &in.LastFailureTime, &out.LastFailureTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextRetryTime != nil {
+		in, out := &in.NextRetryTime, &out.NextRetryTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterModuleRetryStatus.
+func (in *ClusterModuleRetryStatus) DeepCopy() *ClusterModuleRetryStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterModuleRetryStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterOIDCSpec) DeepCopyInto(out *ClusterOIDCSpec) {
+	*out = *in
+	if in.CARef != nil {
+		in, out := &in.CARef, &out.CARef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterOIDCSpec.
+func (in *ClusterOIDCSpec) DeepCopy() *ClusterOIDCSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterOIDCSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterPlugin) DeepCopyInto(out *ClusterPlugin) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPlugin.
@@ -349,35 +710,73 @@ func (in *ClusterPlugin) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ClusterPluginList) DeepCopyInto(out *ClusterPluginList) {
+func (in *ClusterPluginClusterStatus) DeepCopyInto(out *ClusterPluginClusterStatus) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ListMeta.DeepCopyInto(&out.ListMeta)
-	if in.Items != nil {
-		in, out := &in.Items, &out.Items
-		*out = make([]ClusterPlugin, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
+	in.InstallStatus.DeepCopyInto(&out.InstallStatus)
+	in.UninstallStatus.DeepCopyInto(&out.UninstallStatus)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPluginList.
-func (in *ClusterPluginList) DeepCopy() *ClusterPluginList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPluginClusterStatus.
+func (in *ClusterPluginClusterStatus) DeepCopy() *ClusterPluginClusterStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(ClusterPluginList)
+	out := new(ClusterPluginClusterStatus)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *ClusterPluginList) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPluginEntry) DeepCopyInto(out *ClusterPluginEntry) {
+	*out = *in
+	in.Template.DeepCopyInto(&out.Template)
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]string, len(*in))
+		copy(*out, *in)
 	}
-	return nil
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPluginEntry.
+func (in *ClusterPluginEntry) DeepCopy() *ClusterPluginEntry {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPluginEntry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPluginList) DeepCopyInto(out *ClusterPluginList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterPlugin, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPluginList.
+func (in *ClusterPluginList) DeepCopy() *ClusterPluginList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPluginList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterPluginList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
@@ -491,6 +890,11 @@ func (in *ClusterPluginPodSpec) DeepCopyInto(out *ClusterPluginPodSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.PodTemplate != nil {
+		in, out := &in.PodTemplate, &out.PodTemplate
+		*out = new(corev1.PodTemplateSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPluginPodSpec.
@@ -506,6 +910,18 @@ func (in *ClusterPluginPodSpec) DeepCopy() *ClusterPluginPodSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterPluginPodStatus) DeepCopyInto(out *ClusterPluginPodStatus) {
 	*out = *in
+	if in.LastFailureTime != nil {
+		in, out := &in.LastFailureTime, &out.LastFailureTime
+		*out = (*in).DeepCopy()
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPluginPodStatus.
@@ -518,10 +934,45 @@ func (in *ClusterPluginPodStatus) DeepCopy() *ClusterPluginPodStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPluginReference) DeepCopyInto(out *ClusterPluginReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPluginReference.
+func (in *ClusterPluginReference) DeepCopy() *ClusterPluginReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPluginReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPluginRunSummary) DeepCopyInto(out *ClusterPluginRunSummary) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPluginRunSummary.
+func (in *ClusterPluginRunSummary) DeepCopy() *ClusterPluginRunSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPluginRunSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterPluginSpec) DeepCopyInto(out *ClusterPluginSpec) {
 	*out = *in
 	in.CLusterPluginSpecInner.DeepCopyInto(&out.CLusterPluginSpecInner)
+	if in.Template != nil {
+		in, out := &in.Template, &out.Template
+		*out = new(ClusterPluginTemplateRef)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPluginSpec.
@@ -537,8 +988,40 @@ func (in *ClusterPluginSpec) DeepCopy() *ClusterPluginSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterPluginStatus) DeepCopyInto(out *ClusterPluginStatus) {
 	*out = *in
-	out.InstallStatus = in.InstallStatus
-	out.UninstallStatus = in.UninstallStatus
+	in.InstallStatus.DeepCopyInto(&out.InstallStatus)
+	in.UninstallStatus.DeepCopyInto(&out.UninstallStatus)
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]ClusterPluginPodStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	out.Template = in.Template
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]ClusterPluginClusterStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Summary != nil {
+		in, out := &in.Summary, &out.Summary
+		*out = new(ClusterPluginRunSummary)
+		**out = **in
+	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(RolloutStatus)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPluginStatus.
@@ -551,6 +1034,159 @@ func (in *ClusterPluginStatus) DeepCopy() *ClusterPluginStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPluginSummary) DeepCopyInto(out *ClusterPluginSummary) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPluginSummary.
+func (in *ClusterPluginSummary) DeepCopy() *ClusterPluginSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPluginSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPluginTemplate) DeepCopyInto(out *ClusterPluginTemplate) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPluginTemplate.
+func (in *ClusterPluginTemplate) DeepCopy() *ClusterPluginTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPluginTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterPluginTemplate) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPluginTemplateList) DeepCopyInto(out *ClusterPluginTemplateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterPluginTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPluginTemplateList.
+func (in *ClusterPluginTemplateList) DeepCopy() *ClusterPluginTemplateList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPluginTemplateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterPluginTemplateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPluginTemplateParameter) DeepCopyInto(out *ClusterPluginTemplateParameter) {
+	*out = *in
+	if in.Default != nil {
+		in, out := &in.Default, &out.Default
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPluginTemplateParameter.
+func (in *ClusterPluginTemplateParameter) DeepCopy() *ClusterPluginTemplateParameter {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPluginTemplateParameter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPluginTemplateRef) DeepCopyInto(out *ClusterPluginTemplateRef) {
+	*out = *in
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPluginTemplateRef.
+func (in *ClusterPluginTemplateRef) DeepCopy() *ClusterPluginTemplateRef {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPluginTemplateRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPluginTemplateSpec) DeepCopyInto(out *ClusterPluginTemplateSpec) {
+	*out = *in
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make([]ClusterPluginTemplateParameter, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Template.DeepCopyInto(&out.Template)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPluginTemplateSpec.
+func (in *ClusterPluginTemplateSpec) DeepCopy() *ClusterPluginTemplateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPluginTemplateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPluginTemplateStatus) DeepCopyInto(out *ClusterPluginTemplateStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPluginTemplateStatus.
+func (in *ClusterPluginTemplateStatus) DeepCopy() *ClusterPluginTemplateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPluginTemplateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterPostInstallStatus) DeepCopyInto(out *ClusterPostInstallStatus) {
 	*out = *in
@@ -567,6 +1203,98 @@ func (in *ClusterPostInstallStatus) DeepCopy() *ClusterPostInstallStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterRemediationSpec) DeepCopyInto(out *ClusterRemediationSpec) {
+	*out = *in
+	if in.EtcdUnhealthyTimeout != nil {
+		in, out := &in.EtcdUnhealthyTimeout, &out.EtcdUnhealthyTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MinInterval != nil {
+		in, out := &in.MinInterval, &out.MinInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterRemediationSpec.
+func (in *ClusterRemediationSpec) DeepCopy() *ClusterRemediationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterRemediationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterRemediationStatus) DeepCopyInto(out *ClusterRemediationStatus) {
+	*out = *in
+	if in.LastRemediationTime != nil {
+		in, out := &in.LastRemediationTime, &out.LastRemediationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.UnhealthyEtcdMembers != nil {
+		in, out := &in.UnhealthyEtcdMembers, &out.UnhealthyEtcdMembers
+		*out = make([]ClusterUnhealthyMember, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterRemediationStatus.
+func (in *ClusterRemediationStatus) DeepCopy() *ClusterRemediationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterRemediationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterRetiredKey) DeepCopyInto(out *ClusterRetiredKey) {
+	*out = *in
+	in.ExpirationTime.DeepCopyInto(&out.ExpirationTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterRetiredKey.
+func (in *ClusterRetiredKey) DeepCopy() *ClusterRetiredKey {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterRetiredKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterRetrySpec) DeepCopyInto(out *ClusterRetrySpec) {
+	*out = *in
+	if in.BaseDelay != nil {
+		in, out := &in.BaseDelay, &out.BaseDelay
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaxDelay != nil {
+		in, out := &in.MaxDelay, &out.MaxDelay
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterRetrySpec.
+func (in *ClusterRetrySpec) DeepCopy() *ClusterRetrySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterRetrySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterSchedulerSpec) DeepCopyInto(out *ClusterSchedulerSpec) {
 	*out = *in
@@ -583,6 +1311,73 @@ func (in *ClusterSchedulerSpec) DeepCopy() *ClusterSchedulerSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterServiceAccountSpec) DeepCopyInto(out *ClusterServiceAccountSpec) {
+	*out = *in
+	if in.Audiences != nil {
+		in, out := &in.Audiences, &out.Audiences
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.GracePeriod != nil {
+		in, out := &in.GracePeriod, &out.GracePeriod
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterServiceAccountSpec.
+func (in *ClusterServiceAccountSpec) DeepCopy() *ClusterServiceAccountSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterServiceAccountSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterServiceAccountStatus) DeepCopyInto(out *ClusterServiceAccountStatus) {
+	*out = *in
+	if in.RetiredKeys != nil {
+		in, out := &in.RetiredKeys, &out.RetiredKeys
+		*out = make([]ClusterRetiredKey, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterServiceAccountStatus.
+func (in *ClusterServiceAccountStatus) DeepCopy() *ClusterServiceAccountStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterServiceAccountStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterSnapshotSpec) DeepCopyInto(out *ClusterSnapshotSpec) {
+	*out = *in
+	if in.StorageClassName != nil {
+		in, out := &in.StorageClassName, &out.StorageClassName
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterSnapshotSpec.
+func (in *ClusterSnapshotSpec) DeepCopy() *ClusterSnapshotSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterSnapshotSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterSpec) DeepCopyInto(out *ClusterSpec) {
 	*out = *in
@@ -594,12 +1389,29 @@ func (in *ClusterSpec) DeepCopyInto(out *ClusterSpec) {
 	out.AccessSpec = in.AccessSpec
 	out.InitSpec = in.InitSpec
 	out.EtcdSpec = in.EtcdSpec
-	out.ApiServerSpec = in.ApiServerSpec
+	in.ApiServerSpec.DeepCopyInto(&out.ApiServerSpec)
 	out.ControllerManagerSpec = in.ControllerManagerSpec
 	out.SchedulerSpec = in.SchedulerSpec
 	out.ClientSpec = in.ClientSpec
 	out.KubeletSpec = in.KubeletSpec
 	out.KubeProxySpec = in.KubeProxySpec
+	if in.FeatureGates != nil {
+		in, out := &in.FeatureGates, &out.FeatureGates
+		*out = make(map[string]bool, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	in.Remediation.DeepCopyInto(&out.Remediation)
+	in.Retry.DeepCopyInto(&out.Retry)
+	in.Snapshot.DeepCopyInto(&out.Snapshot)
+	if in.Plugins != nil {
+		in, out := &in.Plugins, &out.Plugins
+		*out = make([]ClusterPluginEntry, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterSpec.
@@ -622,6 +1434,28 @@ func (in *ClusterStatus) DeepCopyInto(out *ClusterStatus) {
 	in.Scheduler.DeepCopyInto(&out.Scheduler)
 	in.Client.DeepCopyInto(&out.Client)
 	in.PostInstall.DeepCopyInto(&out.PostInstall)
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Guest.DeepCopyInto(&out.Guest)
+	in.Remediation.DeepCopyInto(&out.Remediation)
+	if in.Retries != nil {
+		in, out := &in.Retries, &out.Retries
+		*out = make([]ClusterModuleRetryStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Deletion.DeepCopyInto(&out.Deletion)
+	if in.Plugins != nil {
+		in, out := &in.Plugins, &out.Plugins
+		*out = make([]ClusterPluginSummary, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterStatus.
@@ -634,6 +1468,38 @@ func (in *ClusterStatus) DeepCopy() *ClusterStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterUnhealthyMember) DeepCopyInto(out *ClusterUnhealthyMember) {
+	*out = *in
+	in.Since.DeepCopyInto(&out.Since)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterUnhealthyMember.
+func (in *ClusterUnhealthyMember) DeepCopy() *ClusterUnhealthyMember {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterUnhealthyMember)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Condition) DeepCopyInto(out *Condition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Condition.
+func (in *Condition) DeepCopy() *Condition {
+	if in == nil {
+		return nil
+	}
+	out := new(Condition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImageBase) DeepCopyInto(out *ImageBase) {
 	*out = *in
@@ -649,13 +1515,35 @@ func (in *ImageBase) DeepCopy() *ImageBase {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IssuedCredential) DeepCopyInto(out *IssuedCredential) {
+	*out = *in
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.NotBefore.DeepCopyInto(&out.NotBefore)
+	in.NotAfter.DeepCopyInto(&out.NotAfter)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IssuedCredential.
+func (in *IssuedCredential) DeepCopy() *IssuedCredential {
+	if in == nil {
+		return nil
+	}
+	out := new(IssuedCredential)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MultiClusterPlugin) DeepCopyInto(out *MultiClusterPlugin) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MultiClusterPlugin.
@@ -716,6 +1604,16 @@ func (in *MultiClusterPluginSpec) DeepCopyInto(out *MultiClusterPluginSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.ClusterSelector != nil {
+		in, out := &in.ClusterSelector, &out.ClusterSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RolloutStrategy != nil {
+		in, out := &in.RolloutStrategy, &out.RolloutStrategy
+		*out = new(RolloutStrategy)
+		(*in).DeepCopyInto(*out)
+	}
 	in.CLusterPluginSpecInner.DeepCopyInto(&out.CLusterPluginSpecInner)
 }
 
@@ -728,3 +1626,142 @@ func (in *MultiClusterPluginSpec) DeepCopy() *MultiClusterPluginSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RolloutStatus) DeepCopyInto(out *RolloutStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RolloutStatus.
+func (in *RolloutStatus) DeepCopy() *RolloutStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RolloutStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RolloutStrategy) DeepCopyInto(out *RolloutStrategy) {
+	*out = *in
+	if in.MaxConcurrent != nil {
+		in, out := &in.MaxConcurrent, &out.MaxConcurrent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxFailures != nil {
+		in, out := &in.MaxFailures, &out.MaxFailures
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RolloutStrategy.
+func (in *RolloutStrategy) DeepCopy() *RolloutStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(RolloutStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountMapping) DeepCopyInto(out *ServiceAccountMapping) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountMapping.
+func (in *ServiceAccountMapping) DeepCopy() *ServiceAccountMapping {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountMapping)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ServiceAccountMapping) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountMappingList) DeepCopyInto(out *ServiceAccountMappingList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ServiceAccountMapping, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountMappingList.
+func (in *ServiceAccountMappingList) DeepCopy() *ServiceAccountMappingList {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountMappingList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ServiceAccountMappingList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountMappingSpec) DeepCopyInto(out *ServiceAccountMappingSpec) {
+	*out = *in
+	out.ServiceAccount = in.ServiceAccount
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountMappingSpec.
+func (in *ServiceAccountMappingSpec) DeepCopy() *ServiceAccountMappingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountMappingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountReference) DeepCopyInto(out *ServiceAccountReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountReference.
+func (in *ServiceAccountReference) DeepCopy() *ServiceAccountReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountReference)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -21,6 +21,8 @@ func init() {
 	cluster.NewClientModules(config)
 	cluster.NewControllerManagerModules(config)
 	cluster.NewEtcdModules(config)
+	cluster.NewEncryptionModules(config)
 	cluster.NewInitModules(config)
 	cluster.NewSchedulerModules(config)
+	cluster.NewServiceAccountModules(config)
 }
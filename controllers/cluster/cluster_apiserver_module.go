@@ -9,9 +9,31 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"net/url"
 	"reflect"
+	"time"
 )
 
+const (
+	oidcMountPath          = "/pki/oidc"
+	authnWebhookMountPath  = "/pki/authn-webhook"
+	hostTokenMountPath     = "/pki/host-token-webhook"
+	authnWebhookKubeconfig = "kubeconfig"
+	defaultOIDCCAKey       = "ca.crt"
+	defaultAuthnWebhookTTL = "2m"
+	aggregationProbePeriod = time.Second * 30
+)
+
+// host apiserver未设置--api-audiences时使用的默认audience
+var hostDefaultAudiences = []string{
+	"api",
+	"https://kubernetes.default.svc",
+	"https://kubernetes.default.svc.cluster.local",
+	"kubernetes.default.svc",
+}
+
 func NewApiServerModules(cfg *controllers.InitConfig) {
 	var apiServerDept = &controllers.Module{
 		GetObj: func() controllers.Object {
@@ -161,12 +183,20 @@ func NewApiServerModules(cfg *controllers.InitConfig) {
 					},
 				},
 			}
+			addEncryptionConfig(c, &out.Spec.Template)
+			addAuthentication(c, &out.Spec.Template)
+			addServiceAccount(c, &out.Spec.Template)
+			addFrontProxy(c, &out.Spec.Template)
+			applyFlagProfile(cfg.Version, componentApiServer, c, &out.Spec.Template)
 			return out
 		},
 		SetStatus: func(c *tanxv1.Cluster, target, now controllers.Object) (bool, controllers.Object) {
 			dept := now.(*v12.Deployment)
 			c.Status.ApiServer.Status = dept.Status
 			c.Status.ApiServer.Name = dept.Name
+			if deploymentRolledOut(dept) {
+				c.Status.ApiServer.Encryption.RolledOutHash = dept.Spec.Template.Annotations[encryptionHashAnnotation]
+			}
 
 			t := target.(*v12.Deployment)
 			n := now.(*v12.Deployment)
@@ -177,12 +207,18 @@ func NewApiServerModules(cfg *controllers.InitConfig) {
 			return false, n
 		},
 		Next: func(c *tanxv1.Cluster) bool {
-			for _, condition := range c.Status.ApiServer.Status.Conditions {
-				if v12.DeploymentAvailable == condition.Type && v1.ConditionTrue == condition.Status {
-					return true
-				}
+			if !deploymentAvailable(c.Status.ApiServer.Status) {
+				return false
+			}
+			return c.Status.Init.FrontProxyPkiName == "" || c.Status.ApiServer.Aggregation.Ready
+		},
+		Probe: probeAggregation,
+		RequeueAfter: func(c *tanxv1.Cluster) time.Duration {
+			a := c.Status.ApiServer.Aggregation
+			if c.Status.Init.FrontProxyPkiName == "" || (a.Ready && a.MetricsAvailable) {
+				return 0
 			}
-			return false
+			return aggregationProbePeriod
 		},
 		SetDefault: func(r *tanxv1.Cluster) {
 			if r.Spec.ApiServerSpec.Image == "" {
@@ -191,6 +227,19 @@ func NewApiServerModules(cfg *controllers.InitConfig) {
 			if r.Spec.ApiServerSpec.Count == 0 {
 				r.Spec.ApiServerSpec.Count = 3
 			}
+			if a := r.Spec.ApiServerSpec.Authentication; a != nil {
+				if a.OIDC != nil && a.OIDC.CARef != nil && a.OIDC.CARef.Key == "" {
+					a.OIDC.CARef.Key = defaultOIDCCAKey
+				}
+				if a.Webhook != nil {
+					if a.Webhook.KubeconfigRef.Key == "" {
+						a.Webhook.KubeconfigRef.Key = authnWebhookKubeconfig
+					}
+					if a.Webhook.CacheTTL == "" {
+						a.Webhook.CacheTTL = defaultAuthnWebhookTTL
+					}
+				}
+			}
 		},
 		ValidateCreateModule: func(r *tanxv1.Cluster) field.ErrorList {
 			var allErrs field.ErrorList
@@ -200,6 +249,8 @@ func NewApiServerModules(cfg *controllers.InitConfig) {
 			if r.Spec.ApiServerSpec.Count <= 0 {
 				allErrs = append(allErrs, field.Invalid(field.NewPath("spec.apiServerSpec.count"), r.Spec.ApiServerSpec.Count, "必须>0"))
 			}
+			allErrs = append(allErrs, validateAuthentication(r.Spec.ApiServerSpec.Authentication)...)
+			allErrs = append(allErrs, validateFeatureGates(cfg.Version, r)...)
 			return allErrs
 		},
 		ValidateUpdateModule: func(now *tanxv1.Cluster, old *tanxv1.Cluster) field.ErrorList {
@@ -210,6 +261,8 @@ func NewApiServerModules(cfg *controllers.InitConfig) {
 			if now.Spec.ApiServerSpec.Count < 0 {
 				allErrs = append(allErrs, field.Invalid(field.NewPath("spec.apiServerSpec.count"), now.Spec.ApiServerSpec.Count, "必须>0"))
 			}
+			allErrs = append(allErrs, validateAuthentication(now.Spec.ApiServerSpec.Authentication)...)
+			allErrs = append(allErrs, validateFeatureGates(cfg.Version, now)...)
 			return allErrs
 		},
 	}
@@ -248,10 +301,202 @@ func NewApiServerModules(cfg *controllers.InitConfig) {
 			return false, now
 		},
 	}
+	var hostTokenWebhook = &controllers.Module{
+		GetObj: func() controllers.Object {
+			return &v1.Secret{}
+		},
+		Render: func(c *tanxv1.Cluster) controllers.Object {
+			out := &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      getHostTokenWebhookName(c),
+					Namespace: c.Namespace,
+				},
+				Data: map[string][]byte{
+					authnWebhookKubeconfig: renderHostTokenWebhookConfig(c),
+				},
+			}
+			return out
+		},
+		SetStatus: func(c *tanxv1.Cluster, target, now controllers.Object) (bool, controllers.Object) {
+			t := target.(*v1.Secret)
+			n := now.(*v1.Secret)
+			if !reflect.DeepEqual(t.Data, n.Data) {
+				n.Data = t.Data
+				return true, n
+			}
+			return false, n
+		},
+		Skip: func(c *tanxv1.Cluster) bool {
+			return !hostServiceAccountEnabled(c)
+		},
+	}
 	var apiServerModule = &controllers.Module{
 		Order: 30,
 		Name:  "apiserver-dept",
-		Sub:   []*controllers.Module{apiServerDept, apiServerSvc},
+		Sub:   []*controllers.Module{hostTokenWebhook, apiServerDept, apiServerSvc},
 	}
 	controllers.AddModules(cfg.Version, apiServerModule)
 }
+
+func addAuthentication(c *tanxv1.Cluster, t *v1.PodTemplateSpec) {
+	a := c.Spec.ApiServerSpec.Authentication
+	if a == nil {
+		return
+	}
+	container := &t.Spec.Containers[0]
+	if o := a.OIDC; o != nil {
+		container.Command = append(container.Command,
+			fmt.Sprintf("--oidc-issuer-url=%s", o.IssuerURL),
+			fmt.Sprintf("--oidc-client-id=%s", o.ClientID),
+		)
+		if o.UsernameClaim != "" {
+			container.Command = append(container.Command, fmt.Sprintf("--oidc-username-claim=%s", o.UsernameClaim))
+		}
+		if o.UsernamePrefix != "" {
+			container.Command = append(container.Command, fmt.Sprintf("--oidc-username-prefix=%s", o.UsernamePrefix))
+		}
+		if o.GroupsClaim != "" {
+			container.Command = append(container.Command, fmt.Sprintf("--oidc-groups-claim=%s", o.GroupsClaim))
+		}
+		if o.GroupsPrefix != "" {
+			container.Command = append(container.Command, fmt.Sprintf("--oidc-groups-prefix=%s", o.GroupsPrefix))
+		}
+		if o.CARef != nil {
+			container.Command = append(container.Command, fmt.Sprintf("--oidc-ca-file=%s/ca.pem", oidcMountPath))
+			container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{
+				Name:      "oidc-ca",
+				ReadOnly:  true,
+				MountPath: oidcMountPath,
+			})
+			t.Spec.Volumes = append(t.Spec.Volumes, v1.Volume{
+				Name: "oidc-ca",
+				VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{
+					SecretName: o.CARef.Name,
+					Items:      []v1.KeyToPath{{Key: o.CARef.Key, Path: "ca.pem"}},
+				}},
+			})
+		}
+	}
+	if w := a.Webhook; w != nil {
+		container.Command = append(container.Command,
+			fmt.Sprintf("--authentication-token-webhook-config-file=%s/%s", authnWebhookMountPath, authnWebhookKubeconfig),
+			fmt.Sprintf("--authentication-token-webhook-cache-ttl=%s", w.CacheTTL),
+		)
+		container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{
+			Name:      "authn-webhook",
+			ReadOnly:  true,
+			MountPath: authnWebhookMountPath,
+		})
+		t.Spec.Volumes = append(t.Spec.Volumes, v1.Volume{
+			Name: "authn-webhook",
+			VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{
+				SecretName: w.KubeconfigRef.Name,
+				Items:      []v1.KeyToPath{{Key: w.KubeconfigRef.Key, Path: authnWebhookKubeconfig}},
+			}},
+		})
+	}
+	if a.HostServiceAccount != nil {
+		container.Command = append(container.Command,
+			fmt.Sprintf("--authentication-token-webhook-config-file=%s/%s", hostTokenMountPath, authnWebhookKubeconfig),
+			fmt.Sprintf("--authentication-token-webhook-cache-ttl=%s", defaultAuthnWebhookTTL),
+		)
+		container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{
+			Name:      "host-token-webhook",
+			ReadOnly:  true,
+			MountPath: hostTokenMountPath,
+		})
+		t.Spec.Volumes = append(t.Spec.Volumes, v1.Volume{
+			Name: "host-token-webhook",
+			VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{
+				SecretName: getHostTokenWebhookName(c),
+			}},
+		})
+	}
+}
+
+func validateAuthentication(a *tanxv1.ClusterAuthenticationSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	if a == nil {
+		return allErrs
+	}
+	if o := a.OIDC; o != nil {
+		p := field.NewPath("spec.apiServer.authentication.oidc")
+		u, err := url.Parse(o.IssuerURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			allErrs = append(allErrs, field.Invalid(p.Child("issuerURL"), o.IssuerURL, "必须为https地址"))
+		}
+		if o.ClientID == "" {
+			allErrs = append(allErrs, field.Invalid(p.Child("clientID"), o.ClientID, "不能为空"))
+		}
+		if o.CARef != nil && o.CARef.Name == "" {
+			allErrs = append(allErrs, field.Invalid(p.Child("caRef", "name"), o.CARef.Name, "不能为空"))
+		}
+	}
+	if w := a.Webhook; w != nil {
+		p := field.NewPath("spec.apiServer.authentication.webhook")
+		if w.KubeconfigRef.Name == "" {
+			allErrs = append(allErrs, field.Invalid(p.Child("kubeconfigRef", "name"), w.KubeconfigRef.Name, "不能为空"))
+		}
+		if _, err := time.ParseDuration(w.CacheTTL); err != nil {
+			allErrs = append(allErrs, field.Invalid(p.Child("cacheTTL"), w.CacheTTL, "格式错误"))
+		}
+		if a.HostServiceAccount != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec.apiServer.authentication.hostServiceAccount"), a.HostServiceAccount, "不能与webhook同时配置"))
+		}
+	}
+	if h := a.HostServiceAccount; h != nil {
+		if !controllers.HostTokenReview.Enabled() {
+			allErrs = append(allErrs, field.Forbidden(field.NewPath("spec.apiServer.authentication.hostServiceAccount"), "kok未配置--token-review-ca-file,不支持host ServiceAccount"))
+		}
+		p := field.NewPath("spec.apiServer.authentication.hostServiceAccount.audiences")
+		//为空或使用host apiserver的默认audience时,host集群中任意ServiceAccount的token都可用于该集群
+		if len(h.Audiences) == 0 {
+			allErrs = append(allErrs, field.Required(p, "需要设置该集群专用的audience"))
+		}
+		for i, audience := range h.Audiences {
+			if stringsContain(hostDefaultAudiences, audience) {
+				allErrs = append(allErrs, field.Invalid(p.Index(i), audience, "不能使用host集群的默认audience,需要设置该集群专用的audience"))
+			}
+		}
+	}
+	return allErrs
+}
+
+func hostServiceAccountEnabled(c *tanxv1.Cluster) bool {
+	a := c.Spec.ApiServerSpec.Authentication
+	return a != nil && a.HostServiceAccount != nil
+}
+
+// guest apiserver通过该kubeconfig调用kok的token review webhook
+func renderHostTokenWebhookConfig(c *tanxv1.Cluster) []byte {
+	config := clientcmdapi.NewConfig()
+	config.Clusters["kok"] = &clientcmdapi.Cluster{
+		Server:                   controllers.HostTokenReview.ClusterURL(c),
+		CertificateAuthorityData: controllers.HostTokenReview.CAData,
+	}
+	//kok只接受集群CA签发且CN为kubernetes-admin的客户端证书,证书与apiserver的serving证书相同(包含client auth用途)
+	config.AuthInfos["apiserver"] = &clientcmdapi.AuthInfo{
+		ClientCertificate: controllers.TokenReviewClientCert,
+		ClientKey:         controllers.TokenReviewClientKey,
+	}
+	config.Contexts["kok"] = &clientcmdapi.Context{
+		Cluster:  "kok",
+		AuthInfo: "apiserver",
+	}
+	config.CurrentContext = "kok"
+	data, _ := clientcmd.Write(*config)
+	return data
+}
+
+func getHostTokenWebhookName(c *tanxv1.Cluster) string {
+	return fmt.Sprintf("%s-host-token-webhook", c.Name)
+}
+
+func stringsContain(s []string, v string) bool {
+	for _, item := range s {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
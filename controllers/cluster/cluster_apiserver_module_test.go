@@ -0,0 +1,96 @@
+package cluster
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tanxv1 "github.com/kok-stack/kok/api/v1"
+	"github.com/kok-stack/kok/controllers"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestValidateAuthentication(t *testing.T) {
+	defer func(ca []byte) { controllers.HostTokenReview.CAData = ca }(controllers.HostTokenReview.CAData)
+
+	oidc := func(issuer, clientID string) *tanxv1.ClusterOIDCSpec {
+		return &tanxv1.ClusterOIDCSpec{IssuerURL: issuer, ClientID: clientID}
+	}
+	webhook := func(name, ttl string) *tanxv1.ClusterAuthenticationWebhookSpec {
+		return &tanxv1.ClusterAuthenticationWebhookSpec{
+			KubeconfigRef: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: "config"},
+			CacheTTL:      ttl,
+		}
+	}
+	host := func(audiences ...string) *tanxv1.ClusterHostServiceAccountSpec {
+		return &tanxv1.ClusterHostServiceAccountSpec{Audiences: audiences}
+	}
+	tests := []struct {
+		name string
+		spec *tanxv1.ClusterAuthenticationSpec
+		noCA bool
+		want []string
+	}{
+		{name: "not set"},
+		{name: "oidc", spec: &tanxv1.ClusterAuthenticationSpec{OIDC: oidc("https://issuer.example.com", "kok")}},
+		{name: "oidc http issuer", spec: &tanxv1.ClusterAuthenticationSpec{OIDC: oidc("http://issuer.example.com", "kok")}, want: []string{"spec.apiServer.authentication.oidc.issuerURL"}},
+		{name: "oidc without client id", spec: &tanxv1.ClusterAuthenticationSpec{OIDC: oidc("https://issuer.example.com", "")}, want: []string{"spec.apiServer.authentication.oidc.clientID"}},
+		{name: "oidc empty ca ref", spec: &tanxv1.ClusterAuthenticationSpec{OIDC: &tanxv1.ClusterOIDCSpec{IssuerURL: "https://issuer.example.com", ClientID: "kok", CARef: &corev1.SecretKeySelector{}}}, want: []string{"spec.apiServer.authentication.oidc.caRef.name"}},
+		{name: "webhook", spec: &tanxv1.ClusterAuthenticationSpec{Webhook: webhook("authn", "2m")}},
+		{name: "webhook without kubeconfig", spec: &tanxv1.ClusterAuthenticationSpec{Webhook: webhook("", "2m")}, want: []string{"spec.apiServer.authentication.webhook.kubeconfigRef.name"}},
+		{name: "webhook invalid ttl", spec: &tanxv1.ClusterAuthenticationSpec{Webhook: webhook("authn", "2")}, want: []string{"spec.apiServer.authentication.webhook.cacheTTL"}},
+		{name: "webhook and host service account", spec: &tanxv1.ClusterAuthenticationSpec{Webhook: webhook("authn", "2m"), HostServiceAccount: host("kok-c")}, want: []string{"spec.apiServer.authentication.hostServiceAccount"}},
+		{name: "host service account", spec: &tanxv1.ClusterAuthenticationSpec{HostServiceAccount: host("kok-c")}},
+		{name: "host service account without audiences", spec: &tanxv1.ClusterAuthenticationSpec{HostServiceAccount: host()}, want: []string{"spec.apiServer.authentication.hostServiceAccount.audiences"}},
+		{name: "host default audience", spec: &tanxv1.ClusterAuthenticationSpec{HostServiceAccount: host("kok-c", "https://kubernetes.default.svc")}, want: []string{"spec.apiServer.authentication.hostServiceAccount.audiences[1]"}},
+		{name: "host token review disabled", spec: &tanxv1.ClusterAuthenticationSpec{HostServiceAccount: host("kok-c")}, noCA: true, want: []string{"spec.apiServer.authentication.hostServiceAccount"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controllers.HostTokenReview.CAData = []byte("ca")
+			if tt.noCA {
+				controllers.HostTokenReview.CAData = nil
+			}
+			var got []string
+			for _, err := range validateAuthentication(tt.spec) {
+				got = append(got, err.Field)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateAuthentication() fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddAuthentication(t *testing.T) {
+	c := testCluster()
+	c.Spec.ApiServerSpec.Authentication = &tanxv1.ClusterAuthenticationSpec{
+		OIDC: &tanxv1.ClusterOIDCSpec{
+			IssuerURL:     "https://issuer.example.com",
+			ClientID:      "kok",
+			UsernameClaim: "email",
+			CARef:         &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "oidc"}, Key: "ca.crt"},
+		},
+		HostServiceAccount: &tanxv1.ClusterHostServiceAccountSpec{Audiences: []string{"kok-c"}},
+	}
+	tpl := testPodTemplate("kube-apiserver")
+	addAuthentication(c, tpl)
+	cmd := strings.Join(tpl.Spec.Containers[0].Command, " ")
+	for _, flag := range []string{
+		"--oidc-issuer-url=https://issuer.example.com",
+		"--oidc-client-id=kok",
+		"--oidc-username-claim=email",
+		"--oidc-ca-file=" + oidcMountPath + "/ca.pem",
+		"--authentication-token-webhook-config-file=" + hostTokenMountPath + "/" + authnWebhookKubeconfig,
+	} {
+		if !strings.Contains(cmd, flag) {
+			t.Errorf("missing %s in %s", flag, cmd)
+		}
+	}
+	if strings.Contains(cmd, "--oidc-groups-claim") {
+		t.Errorf("unset groups claim rendered: %s", cmd)
+	}
+	if len(tpl.Spec.Volumes) != 2 || len(tpl.Spec.Containers[0].VolumeMounts) != 2 {
+		t.Errorf("volumes = %v, mounts = %v", tpl.Spec.Volumes, tpl.Spec.Containers[0].VolumeMounts)
+	}
+}
@@ -10,8 +10,11 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	"reflect"
+	"time"
 )
 
+var postInstallBackoffLimit int32 = 3
+
 func NewClientModules(cfg *controllers.InitConfig) {
 	var clientDept = &controllers.Module{
 		GetObj: func() controllers.Object {
@@ -138,6 +141,9 @@ func NewClientModules(cfg *controllers.InitConfig) {
 			}
 			return false, n
 		},
+		Next: func(c *tanxv1.Cluster) bool {
+			return deploymentAvailable(c.Status.Client.Status)
+		},
 		SetDefault: func(r *tanxv1.Cluster) {
 			if r.Spec.ClientSpec.Image == "" {
 				r.Spec.ClientSpec.Image = cfg.ClientImage
@@ -171,6 +177,7 @@ func NewClientModules(cfg *controllers.InitConfig) {
 				"app":     out.Name,
 			}
 			out.Spec = v13.JobSpec{
+				BackoffLimit: &postInstallBackoffLimit,
 				Template: v1.PodTemplateSpec{
 					ObjectMeta: metav1.ObjectMeta{
 						Name:   out.Name,
@@ -180,15 +187,11 @@ func NewClientModules(cfg *controllers.InitConfig) {
 						Containers: []v1.Container{{
 							Name:  "install-post",
 							Image: c.Spec.InitSpec.Image,
+							//使用apply保证job重试时可重复执行
 							Command: []string{
-								"kubectl",
-								"--kubeconfig=admin/admin.config",
-								"create",
-								"clusterrolebinding",
-								"cluster-node",
-								"--clusterrole=cluster-admin",
-								"--user=kubernetes-node",
-								"--group=system:node",
+								"sh",
+								"-c",
+								"kubectl --kubeconfig=/home/admin/admin.config create clusterrolebinding cluster-node --clusterrole=cluster-admin --user=kubernetes-node --group=system:node --dry-run -o yaml | kubectl --kubeconfig=/home/admin/admin.config apply -f -",
 							},
 							VolumeMounts: []v1.VolumeMount{
 								{
@@ -268,6 +271,19 @@ func NewClientModules(cfg *controllers.InitConfig) {
 
 			return false, now
 		},
+		Next: func(c *tanxv1.Cluster) bool {
+			return jobComplete(c.Status.PostInstall.Status)
+		},
+		Recreate: func(c *tanxv1.Cluster, now controllers.Object) bool {
+			if !jobFailed(now.(*v13.Job).Status) || !controllers.RemediateJob(c, now.GetName()) {
+				return false
+			}
+			c.Status.PostInstall.Retries++
+			return true
+		},
+		RequeueAfter: func(c *tanxv1.Cluster) time.Duration {
+			return controllers.FailedJobRequeue(c, jobFailed(c.Status.PostInstall.Status))
+		},
 	}
 	var clientModule = &controllers.Module{
 		Order: 60,
@@ -58,11 +58,8 @@ func NewControllerManagerModules(cfg *controllers.InitConfig) {
 										"--node-cidr-mask-size=24",
 										"--requestheader-client-ca-file=/pki/ca/ca.pem",
 										"--root-ca-file=/pki/ca/ca.pem",
-										"--service-account-private-key-file=/pki/server/kubernetes-server-key.pem",
 										fmt.Sprintf("--service-cluster-ip-range=%s", c.Spec.ServiceClusterIpRange),
 										"--use-service-account-credentials=true",
-										//在virtual kubelet下,在loadbalance的service中排除virtual node
-										"--feature-gates=ServiceNodeExclusion=true",
 									},
 									LivenessProbe: &v1.Probe{
 										InitialDelaySeconds: 10,
@@ -100,11 +97,6 @@ func NewControllerManagerModules(cfg *controllers.InitConfig) {
 											ReadOnly:  true,
 											MountPath: "/pki/ca",
 										},
-										{
-											Name:      "k8s-server",
-											ReadOnly:  true,
-											MountPath: "/pki/server",
-										},
 										{
 											Name:      "k8s-config",
 											ReadOnly:  true,
@@ -118,11 +110,6 @@ func NewControllerManagerModules(cfg *controllers.InitConfig) {
 								VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{
 									SecretName: c.Status.Init.CaPkiName,
 								}},
-							}, {
-								Name: "k8s-server",
-								VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{
-									SecretName: c.Status.Init.ServerName,
-								}},
 							}, {
 								Name: "k8s-config",
 								VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{
@@ -140,6 +127,9 @@ func NewControllerManagerModules(cfg *controllers.InitConfig) {
 					},
 				},
 			}
+			addServiceAccountSigner(c, &out.Spec.Template)
+			addFrontProxyCA(c, &out.Spec.Template)
+			applyFlagProfile(cfg.Version, componentControllerManager, c, &out.Spec.Template)
 			return out
 		},
 		SetStatus: func(c *tanxv1.Cluster, target, now controllers.Object) (bool, controllers.Object) {
@@ -155,6 +145,9 @@ func NewControllerManagerModules(cfg *controllers.InitConfig) {
 			}
 			return false, n
 		},
+		Next: func(c *tanxv1.Cluster) bool {
+			return deploymentAvailable(c.Status.ControllerManager.Status)
+		},
 		SetDefault: func(r *tanxv1.Cluster) {
 			if r.Spec.ControllerManagerSpec.Image == "" {
 				r.Spec.ControllerManagerSpec.Image = cfg.ControllerManagerImage
@@ -0,0 +1,361 @@
+package cluster
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	tanxv1 "github.com/kok-stack/kok/api/v1"
+	"github.com/kok-stack/kok/controllers"
+	v12 "k8s.io/api/apps/v1"
+	v13 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	encryptionConfigKey      = "encryption-config.yaml"
+	encryptionMountPath      = "/pki/encryption"
+	encryptionHashAnnotation = "kok.tanx/encryption-config-hash"
+
+	encryptionProviderAescbc    = "aescbc"
+	encryptionProviderSecretbox = "secretbox"
+)
+
+// encryptionRewriteScript 逐个replace,期间被修改或删除的secret已由其他写入按新密钥加密,跳过即可,避免整体replace因冲突失败
+const encryptionRewriteScript = `K="kubectl --kubeconfig=/home/admin/admin.config"
+$K get secrets --all-namespaces -o jsonpath='{range .items[*]}{.metadata.namespace}{" "}{.metadata.name}{"\n"}{end}' > /tmp/secrets || exit 1
+while read ns name; do
+  $K -n "$ns" get secret "$name" -o json | $K replace -f - || echo "skip $ns/$name"
+done < /tmp/secrets`
+
+type encryptionConfiguration struct {
+	Kind       string               `json:"kind"`
+	ApiVersion string               `json:"apiVersion"`
+	Resources  []encryptionResource `json:"resources"`
+}
+
+type encryptionResource struct {
+	Resources []string             `json:"resources"`
+	Providers []encryptionProvider `json:"providers"`
+}
+
+type encryptionProvider struct {
+	Aescbc    *encryptionKeys `json:"aescbc,omitempty"`
+	Secretbox *encryptionKeys `json:"secretbox,omitempty"`
+	Identity  *struct{}       `json:"identity,omitempty"`
+}
+
+type encryptionKeys struct {
+	Keys []encryptionKey `json:"keys"`
+}
+
+type encryptionKey struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret"`
+}
+
+func NewEncryptionModules(cfg *controllers.InitConfig) {
+	var encryptionSecret = &controllers.Module{
+		GetObj: func() controllers.Object {
+			return &v1.Secret{}
+		},
+		Render: func(c *tanxv1.Cluster) controllers.Object {
+			out := &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      getEncryptionConfigName(c),
+					Namespace: c.Namespace,
+				},
+			}
+			if c.Spec.ApiServerSpec.Encryption == nil {
+				return out
+			}
+			key := newEncryptionKey(c.Spec.ApiServerSpec.Encryption.RotationGeneration)
+			out.Data = map[string][]byte{
+				encryptionConfigKey: renderEncryptionConfig(c.Spec.ApiServerSpec.Encryption.Provider, []encryptionKey{key}),
+			}
+			return out
+		},
+		SetStatus: func(c *tanxv1.Cluster, target, now controllers.Object) (bool, controllers.Object) {
+			secret := now.(*v1.Secret)
+			status := &c.Status.ApiServer.Encryption
+			status.SecretName = secret.Name
+
+			keys, err := parseEncryptionKeys(secret.Data[encryptionConfigKey])
+			if err != nil {
+				return false, now
+			}
+			next, changed := nextEncryptionKeys(c, keys)
+			if changed {
+				secret.Data[encryptionConfigKey] = renderEncryptionConfig(c.Spec.ApiServerSpec.Encryption.Provider, next)
+			}
+			status.Keys = make([]string, len(next))
+			for i, key := range next {
+				status.Keys[i] = key.Name
+			}
+			status.ConfigHash = hashData(secret.Data[encryptionConfigKey])
+			return changed, secret
+		},
+		Retain: true,
+		Skip: func(c *tanxv1.Cluster) bool {
+			return c.Spec.ApiServerSpec.Encryption == nil
+		},
+		SetDefault: func(r *tanxv1.Cluster) {
+			if r.Spec.ApiServerSpec.Encryption != nil && r.Spec.ApiServerSpec.Encryption.Provider == "" {
+				r.Spec.ApiServerSpec.Encryption.Provider = encryptionProviderAescbc
+			}
+		},
+		ValidateCreateModule: func(r *tanxv1.Cluster) field.ErrorList {
+			var allErrs field.ErrorList
+			e := r.Spec.ApiServerSpec.Encryption
+			if e == nil {
+				return allErrs
+			}
+			if e.Provider != encryptionProviderAescbc && e.Provider != encryptionProviderSecretbox {
+				allErrs = append(allErrs, field.Invalid(field.NewPath("spec.apiServer.encryption.provider"), e.Provider, "只支持aescbc,secretbox"))
+			}
+			if e.RotationGeneration < 0 {
+				allErrs = append(allErrs, field.Invalid(field.NewPath("spec.apiServer.encryption.rotationGeneration"), e.RotationGeneration, "不能<0"))
+			}
+			return allErrs
+		},
+		ValidateUpdateModule: func(now *tanxv1.Cluster, old *tanxv1.Cluster) field.ErrorList {
+			var allErrs field.ErrorList
+			n := now.Spec.ApiServerSpec.Encryption
+			o := old.Spec.ApiServerSpec.Encryption
+			if o == nil {
+				return allErrs
+			}
+			if n == nil {
+				allErrs = append(allErrs, field.Invalid(field.NewPath("spec.apiServer.encryption"), n, "开启后不允许关闭"))
+				return allErrs
+			}
+			if n.Provider != o.Provider {
+				allErrs = append(allErrs, field.Invalid(field.NewPath("spec.apiServer.encryption.provider"), n.Provider, "不允许修改"))
+			}
+			if n.RotationGeneration < o.RotationGeneration {
+				allErrs = append(allErrs, field.Invalid(field.NewPath("spec.apiServer.encryption.rotationGeneration"), n.RotationGeneration, "不允许减小"))
+			}
+			return allErrs
+		},
+	}
+
+	var rewriteJob = &controllers.Module{
+		GetObj: func() controllers.Object {
+			return &v13.Job{}
+		},
+		Render: func(c *tanxv1.Cluster) controllers.Object {
+			out := &v13.Job{}
+			out.Name = fmt.Sprintf("%s-encryption-rewrite-%d", c.Name, c.Status.ApiServer.Encryption.ObservedRotation)
+			out.Namespace = c.Namespace
+			out.Labels = map[string]string{
+				"cluster": c.Name,
+				"app":     out.Name,
+			}
+			out.Spec = v13.JobSpec{
+				Template: v1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   out.Name,
+						Labels: out.Labels,
+					},
+					Spec: v1.PodSpec{
+						Containers: []v1.Container{{
+							Name:  "rewrite",
+							Image: c.Spec.InitSpec.Image,
+							Command: []string{
+								"sh",
+								"-c",
+								encryptionRewriteScript,
+							},
+							VolumeMounts: []v1.VolumeMount{
+								{
+									Name:      "adminconfig",
+									ReadOnly:  true,
+									MountPath: "/home/admin",
+								},
+							},
+						}},
+						Volumes: []v1.Volume{{
+							Name: "adminconfig",
+							VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{
+								SecretName: c.Status.Init.AdminConfigName,
+							}},
+						}},
+						RestartPolicy: v1.RestartPolicyNever,
+					},
+				},
+			}
+			return out
+		},
+		SetStatus: func(c *tanxv1.Cluster, target, now controllers.Object) (bool, controllers.Object) {
+			job := now.(*v13.Job)
+			c.Status.ApiServer.Encryption.RewriteJobName = job.Name
+			c.Status.ApiServer.Encryption.RewriteStatus = job.Status
+			return false, now
+		},
+		Skip: func(c *tanxv1.Cluster) bool {
+			return c.Spec.ApiServerSpec.Encryption == nil || c.Status.ApiServer.Encryption.Phase != tanxv1.EncryptionRewriting
+		},
+	}
+
+	var encryptionModule = &controllers.Module{
+		Order: 25,
+		Name:  "encryption-config",
+		Sub:   []*controllers.Module{encryptionSecret, rewriteJob},
+	}
+	controllers.AddModules(cfg.Version, encryptionModule)
+}
+
+// 轮换流程:新增密钥(非首位)->提升新密钥为首位->重写所有secret->移除旧密钥,每次修改配置后都需等待apiserver滚动完成.
+// 首次开启加密时密钥已在首位,等待apiserver滚动后重写一次secret,加密开启前写入的secret不再保持明文
+func nextEncryptionKeys(c *tanxv1.Cluster, keys []encryptionKey) ([]encryptionKey, bool) {
+	spec := c.Spec.ApiServerSpec.Encryption
+	status := &c.Status.ApiServer.Encryption
+	rolledOut := status.ConfigHash != "" && status.RolledOutHash == status.ConfigHash
+
+	switch status.Phase {
+	case "":
+		status.Phase = tanxv1.EncryptionKeyPromoted
+		status.ObservedRotation = spec.RotationGeneration
+	case tanxv1.EncryptionReady:
+		if spec.RotationGeneration <= status.ObservedRotation || len(keys) == 0 {
+			return keys, false
+		}
+		status.ObservedRotation = spec.RotationGeneration
+		status.Phase = tanxv1.EncryptionKeyAdded
+		return append(keys, newEncryptionKey(spec.RotationGeneration)), true
+	case tanxv1.EncryptionKeyAdded:
+		if !rolledOut || len(keys) < 2 {
+			return keys, false
+		}
+		status.Phase = tanxv1.EncryptionKeyPromoted
+		return []encryptionKey{keys[len(keys)-1], keys[0]}, true
+	case tanxv1.EncryptionKeyPromoted:
+		if !rolledOut {
+			return keys, false
+		}
+		status.Phase = tanxv1.EncryptionRewriting
+		status.RewriteJobName = ""
+		status.RewriteStatus = v13.JobStatus{}
+	case tanxv1.EncryptionRewriting:
+		if status.RewriteJobName != fmt.Sprintf("%s-encryption-rewrite-%d", c.Name, status.ObservedRotation) || !jobComplete(status.RewriteStatus) {
+			return keys, false
+		}
+		status.Phase = tanxv1.EncryptionOldKeyRemoved
+		return keys[:1], len(keys) > 1
+	case tanxv1.EncryptionOldKeyRemoved:
+		if rolledOut {
+			status.Phase = tanxv1.EncryptionReady
+		}
+	}
+	return keys, false
+}
+
+// apiserver使用的加密配置,通过pod annotation中的hash触发滚动更新
+func addEncryptionConfig(c *tanxv1.Cluster, t *v1.PodTemplateSpec) {
+	status := c.Status.ApiServer.Encryption
+	if c.Spec.ApiServerSpec.Encryption == nil || status.SecretName == "" {
+		return
+	}
+	container := &t.Spec.Containers[0]
+	container.Command = append(container.Command, fmt.Sprintf("--encryption-provider-config=%s/%s", encryptionMountPath, encryptionConfigKey))
+	container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{
+		Name:      "encryption-config",
+		ReadOnly:  true,
+		MountPath: encryptionMountPath,
+	})
+	t.Spec.Volumes = append(t.Spec.Volumes, v1.Volume{
+		Name: "encryption-config",
+		VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{
+			SecretName: status.SecretName,
+		}},
+	})
+	if t.Annotations == nil {
+		t.Annotations = map[string]string{}
+	}
+	t.Annotations[encryptionHashAnnotation] = status.ConfigHash
+}
+
+func deploymentRolledOut(dept *v12.Deployment) bool {
+	if dept.Spec.Replicas == nil || dept.Status.ObservedGeneration < dept.Generation {
+		return false
+	}
+	return dept.Status.UpdatedReplicas == *dept.Spec.Replicas &&
+		dept.Status.Replicas == *dept.Spec.Replicas &&
+		dept.Status.AvailableReplicas == *dept.Spec.Replicas
+}
+
+func jobComplete(status v13.JobStatus) bool {
+	for _, condition := range status.Conditions {
+		if v13.JobComplete == condition.Type && v1.ConditionTrue == condition.Status {
+			return true
+		}
+	}
+	return false
+}
+
+func jobFailed(status v13.JobStatus) bool {
+	for _, condition := range status.Conditions {
+		if v13.JobFailed == condition.Type && v1.ConditionTrue == condition.Status {
+			return true
+		}
+	}
+	return false
+}
+
+func newEncryptionKey(generation int64) encryptionKey {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	return encryptionKey{
+		Name:   fmt.Sprintf("key-%d", generation),
+		Secret: base64.StdEncoding.EncodeToString(secret),
+	}
+}
+
+func renderEncryptionConfig(provider string, keys []encryptionKey) []byte {
+	p := encryptionProvider{}
+	if provider == encryptionProviderSecretbox {
+		p.Secretbox = &encryptionKeys{Keys: keys}
+	} else {
+		p.Aescbc = &encryptionKeys{Keys: keys}
+	}
+	config := encryptionConfiguration{
+		Kind:       "EncryptionConfiguration",
+		ApiVersion: "apiserver.config.k8s.io/v1",
+		Resources: []encryptionResource{{
+			Resources: []string{"secrets"},
+			//identity放在最后,保证开启前写入的明文数据仍可读取
+			Providers: []encryptionProvider{p, {Identity: &struct{}{}}},
+		}},
+	}
+	data, _ := yaml.Marshal(config)
+	return data
+}
+
+func parseEncryptionKeys(data []byte) ([]encryptionKey, error) {
+	config := &encryptionConfiguration{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	for _, resource := range config.Resources {
+		for _, provider := range resource.Providers {
+			if provider.Aescbc != nil {
+				return provider.Aescbc.Keys, nil
+			}
+			if provider.Secretbox != nil {
+				return provider.Secretbox.Keys, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no encryption keys found")
+}
+
+func hashData(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))[:16]
+}
+
+func getEncryptionConfigName(c *tanxv1.Cluster) string {
+	return fmt.Sprintf("%s-encryption-config", c.Name)
+}
@@ -0,0 +1,130 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+
+	tanxv1 "github.com/kok-stack/kok/api/v1"
+	v13 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+func keyNames(keys []encryptionKey) []string {
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = key.Name
+	}
+	return names
+}
+
+func TestNextEncryptionKeys(t *testing.T) {
+	k0 := newEncryptionKey(0)
+	k1 := newEncryptionKey(1)
+	complete := v13.JobStatus{Conditions: []v13.JobCondition{{Type: v13.JobComplete, Status: v1.ConditionTrue}}}
+	tests := []struct {
+		name        string
+		rotation    int64
+		status      tanxv1.ClusterEncryptionStatus
+		keys        []encryptionKey
+		wantKeys    []string
+		wantChanged bool
+		wantPhase   tanxv1.ClusterEncryptionPhase
+	}{
+		{
+			name:      "first enable rewrites existing secrets",
+			keys:      []encryptionKey{k0},
+			wantKeys:  []string{k0.Name},
+			wantPhase: tanxv1.EncryptionKeyPromoted,
+		},
+		{
+			name:      "ready without rotation",
+			status:    tanxv1.ClusterEncryptionStatus{Phase: tanxv1.EncryptionReady},
+			keys:      []encryptionKey{k0},
+			wantKeys:  []string{k0.Name},
+			wantPhase: tanxv1.EncryptionReady,
+		},
+		{
+			name:        "rotation adds key",
+			rotation:    1,
+			status:      tanxv1.ClusterEncryptionStatus{Phase: tanxv1.EncryptionReady},
+			keys:        []encryptionKey{k0},
+			wantKeys:    []string{k0.Name, k1.Name},
+			wantChanged: true,
+			wantPhase:   tanxv1.EncryptionKeyAdded,
+		},
+		{
+			name:      "added key waits for rollout",
+			rotation:  1,
+			status:    tanxv1.ClusterEncryptionStatus{Phase: tanxv1.EncryptionKeyAdded, ObservedRotation: 1, ConfigHash: "b", RolledOutHash: "a"},
+			keys:      []encryptionKey{k0, k1},
+			wantKeys:  []string{k0.Name, k1.Name},
+			wantPhase: tanxv1.EncryptionKeyAdded,
+		},
+		{
+			name:        "promote new key",
+			rotation:    1,
+			status:      tanxv1.ClusterEncryptionStatus{Phase: tanxv1.EncryptionKeyAdded, ObservedRotation: 1, ConfigHash: "b", RolledOutHash: "b"},
+			keys:        []encryptionKey{k0, k1},
+			wantKeys:    []string{k1.Name, k0.Name},
+			wantChanged: true,
+			wantPhase:   tanxv1.EncryptionKeyPromoted,
+		},
+		{
+			name:      "rewrite after promotion",
+			rotation:  1,
+			status:    tanxv1.ClusterEncryptionStatus{Phase: tanxv1.EncryptionKeyPromoted, ObservedRotation: 1, ConfigHash: "c", RolledOutHash: "c"},
+			keys:      []encryptionKey{k1, k0},
+			wantKeys:  []string{k1.Name, k0.Name},
+			wantPhase: tanxv1.EncryptionRewriting,
+		},
+		{
+			name:      "rewrite job not complete",
+			rotation:  1,
+			status:    tanxv1.ClusterEncryptionStatus{Phase: tanxv1.EncryptionRewriting, ObservedRotation: 1, RewriteJobName: "c-encryption-rewrite-1"},
+			keys:      []encryptionKey{k1, k0},
+			wantKeys:  []string{k1.Name, k0.Name},
+			wantPhase: tanxv1.EncryptionRewriting,
+		},
+		{
+			name:        "remove old key after rewrite",
+			rotation:    1,
+			status:      tanxv1.ClusterEncryptionStatus{Phase: tanxv1.EncryptionRewriting, ObservedRotation: 1, RewriteJobName: "c-encryption-rewrite-1", RewriteStatus: complete},
+			keys:        []encryptionKey{k1, k0},
+			wantKeys:    []string{k1.Name},
+			wantChanged: true,
+			wantPhase:   tanxv1.EncryptionOldKeyRemoved,
+		},
+		{
+			name:      "first rewrite keeps single key",
+			status:    tanxv1.ClusterEncryptionStatus{Phase: tanxv1.EncryptionRewriting, RewriteJobName: "c-encryption-rewrite-0", RewriteStatus: complete},
+			keys:      []encryptionKey{k0},
+			wantKeys:  []string{k0.Name},
+			wantPhase: tanxv1.EncryptionOldKeyRemoved,
+		},
+		{
+			name:      "ready after rollout",
+			rotation:  1,
+			status:    tanxv1.ClusterEncryptionStatus{Phase: tanxv1.EncryptionOldKeyRemoved, ObservedRotation: 1, ConfigHash: "d", RolledOutHash: "d"},
+			keys:      []encryptionKey{k1},
+			wantKeys:  []string{k1.Name},
+			wantPhase: tanxv1.EncryptionReady,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testCluster()
+			c.Spec.ApiServerSpec.Encryption = &tanxv1.ClusterEncryptionSpec{Provider: encryptionProviderAescbc, RotationGeneration: tt.rotation}
+			c.Status.ApiServer.Encryption = tt.status
+			keys, changed := nextEncryptionKeys(c, tt.keys)
+			if changed != tt.wantChanged {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if got := keyNames(keys); !reflect.DeepEqual(got, tt.wantKeys) {
+				t.Errorf("keys = %v, want %v", got, tt.wantKeys)
+			}
+			if c.Status.ApiServer.Encryption.Phase != tt.wantPhase {
+				t.Errorf("phase = %s, want %s", c.Status.ApiServer.Encryption.Phase, tt.wantPhase)
+			}
+		})
+	}
+}
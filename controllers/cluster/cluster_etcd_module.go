@@ -53,6 +53,7 @@ func NewEtcdModules(cfg *controllers.InitConfig) {
 			}
 			return false, n
 		},
+		Retain: true,
 		Next: func(c *tanxv1.Cluster) bool {
 			if len(c.Status.Etcd.Status.Members.Ready) == c.Status.Etcd.Status.Size && (c.Status.Etcd.Status.Size == c.Spec.EtcdSpec.Count) {
 				return true
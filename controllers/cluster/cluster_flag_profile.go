@@ -0,0 +1,190 @@
+package cluster
+
+import (
+	"fmt"
+	tanxv1 "github.com/kok-stack/kok/api/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	componentApiServer         = "kube-apiserver"
+	componentControllerManager = "kube-controller-manager"
+	componentScheduler         = "kube-scheduler"
+
+	featureGatesFlag = "--feature-gates="
+)
+
+// flagChange 某个minor版本起参数被移除(RenameTo为空)或改名
+type flagChange struct {
+	Flag     string
+	Since    int
+	RenameTo string
+}
+
+// featureGate 在[Added,Removed)区间的minor版本中可用,Removed为0表示仍可用.Locked起GA,只能为true.
+// 未记录的特性视为不存在,webhook拒绝,避免拼写错误导致组件因unrecognized feature gate无法启动
+type featureGate struct {
+	Added   int
+	Removed int
+	Locked  int
+}
+
+var flagChanges = map[string][]flagChange{
+	componentApiServer: {
+		{Flag: "--insecure-port", Since: 24},
+		{Flag: "--kubelet-https", Since: 22},
+		{Flag: "--service-account-api-audiences", Since: 13, RenameTo: "--api-audiences"},
+		{Flag: "--enable-swagger-ui", Since: 14},
+	},
+	componentControllerManager: {
+		{Flag: "--port", Since: 24},
+		{Flag: "--address", Since: 24},
+		{Flag: "--horizontal-pod-autoscaler-use-rest-clients", Since: 24},
+	},
+	componentScheduler: {
+		{Flag: "--port", Since: 23},
+		{Flag: "--address", Since: 23},
+	},
+}
+
+var featureGates = map[string]featureGate{
+	"BoundServiceAccountTokenVolume": {Added: 13, Removed: 23, Locked: 22},
+	"CSIMigration":                   {Added: 14, Locked: 25},
+	"CSIStorageCapacity":             {Added: 19, Removed: 28, Locked: 24},
+	"EndpointSlice":                  {Added: 16, Removed: 25, Locked: 21},
+	"EphemeralContainers":            {Added: 16, Locked: 25},
+	"ExpandCSIVolumes":               {Added: 14, Removed: 27, Locked: 24},
+	"ExpandPersistentVolumes":        {Added: 8, Removed: 27, Locked: 24},
+	"GracefulNodeShutdown":           {Added: 20},
+	"HPAScaleToZero":                 {Added: 16},
+	"IPv6DualStack":                  {Added: 16, Removed: 25, Locked: 23},
+	"MixedProtocolLBService":         {Added: 20, Removed: 28, Locked: 26},
+	"NodeLease":                      {Added: 12, Removed: 23, Locked: 17},
+	"PodDisruptionBudget":            {Added: 3, Removed: 25, Locked: 21},
+	"PodSecurity":                    {Added: 22, Removed: 28, Locked: 25},
+	"RemoveSelfLink":                 {Added: 16, Removed: 24},
+	"ServiceAccountIssuerDiscovery":  {Added: 18, Removed: 23, Locked: 21},
+	"ServiceNodeExclusion":           {Added: 8, Removed: 22, Locked: 21},
+	"ServiceTopology":                {Added: 17, Removed: 22},
+	"StartupProbe":                   {Added: 16, Removed: 23, Locked: 20},
+	"TTLAfterFinished":               {Added: 12, Removed: 25, Locked: 23},
+	"TaintBasedEvictions":            {Added: 6, Removed: 20, Locked: 18},
+	"TopologyManager":                {Added: 16, Locked: 27},
+}
+
+// 组件默认开启的特性,版本不支持或已GA时自动忽略
+var defaultFeatureGates = map[string]map[string]bool{
+	//在virtual kubelet下,在loadbalance的service中排除virtual node
+	componentControllerManager: {"ServiceNodeExclusion": true},
+}
+
+// 版本格式为<arch>-<major>.<minor>.<patch>,如x86-1.18.4
+func kubeMinorVersion(version string) (int, error) {
+	split := strings.Split(version, tanxv1.VersionSeparator)
+	v := strings.Split(split[len(split)-1], ".")
+	if len(v) < 2 {
+		return 0, fmt.Errorf("invalid version %s", version)
+	}
+	return strconv.Atoi(v[1])
+}
+
+func featureGateAvailable(name string, minor int) bool {
+	gate, ok := featureGates[name]
+	return ok && minor >= gate.Added && (gate.Removed == 0 || minor < gate.Removed)
+}
+
+func featureGateLocked(name string, minor int) bool {
+	gate, ok := featureGates[name]
+	return ok && gate.Locked != 0 && minor >= gate.Locked
+}
+
+// applyFlagProfile 按版本处理废弃参数,并将组件默认特性与spec.featureGates合并为一个--feature-gates参数
+func applyFlagProfile(version string, component string, c *tanxv1.Cluster, t *v1.PodTemplateSpec) {
+	minor, err := kubeMinorVersion(version)
+	if err != nil {
+		return
+	}
+	container := &t.Spec.Containers[0]
+	gates := map[string]bool{}
+	for name, enabled := range defaultFeatureGates[component] {
+		gates[name] = enabled
+	}
+	for name, enabled := range c.Spec.FeatureGates {
+		gates[name] = enabled
+	}
+
+	command := make([]string, 0, len(container.Command))
+	for _, arg := range container.Command {
+		if strings.HasPrefix(arg, featureGatesFlag) {
+			for _, kv := range strings.Split(strings.TrimPrefix(arg, featureGatesFlag), ",") {
+				split := strings.SplitN(kv, "=", 2)
+				if _, ok := gates[split[0]]; !ok && len(split) == 2 {
+					gates[split[0]] = split[1] == "true"
+				}
+			}
+			continue
+		}
+		arg, keep := changeFlag(component, minor, arg)
+		if keep {
+			command = append(command, arg)
+		}
+	}
+
+	//已GA的特性始终开启,不再传给组件
+	var enabled []string
+	for name, value := range gates {
+		if featureGateAvailable(name, minor) && !featureGateLocked(name, minor) {
+			enabled = append(enabled, fmt.Sprintf("%s=%t", name, value))
+		}
+	}
+	if len(enabled) > 0 {
+		sort.Strings(enabled)
+		command = append(command, featureGatesFlag+strings.Join(enabled, ","))
+	}
+	container.Command = command
+}
+
+func changeFlag(component string, minor int, arg string) (string, bool) {
+	name := strings.SplitN(arg, "=", 2)[0]
+	for _, change := range flagChanges[component] {
+		if change.Flag != name || minor < change.Since {
+			continue
+		}
+		if change.RenameTo == "" {
+			return arg, false
+		}
+		return change.RenameTo + strings.TrimPrefix(arg, name), true
+	}
+	return arg, true
+}
+
+func validateFeatureGates(version string, c *tanxv1.Cluster) field.ErrorList {
+	var allErrs field.ErrorList
+	minor, err := kubeMinorVersion(version)
+	if err != nil {
+		return append(allErrs, field.Invalid(field.NewPath("spec.clusterVersion"), version, err.Error()))
+	}
+	for name, enabled := range c.Spec.FeatureGates {
+		if _, ok := featureGates[name]; !ok {
+			allErrs = append(allErrs, field.NotSupported(field.NewPath("spec.featureGates").Key(name), name, featureGateNames()))
+		} else if !featureGateAvailable(name, minor) {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec.featureGates").Key(name), name, fmt.Sprintf("版本%s不支持该特性", version)))
+		} else if !enabled && featureGateLocked(name, minor) {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec.featureGates").Key(name), enabled, fmt.Sprintf("版本%s该特性已GA,不允许关闭", version)))
+		}
+	}
+	return allErrs
+}
+
+func featureGateNames() []string {
+	names := make([]string, 0, len(featureGates))
+	for name := range featureGates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
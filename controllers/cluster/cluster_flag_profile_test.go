@@ -0,0 +1,121 @@
+package cluster
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyFlagProfile(t *testing.T) {
+	tests := []struct {
+		name      string
+		version   string
+		component string
+		gates     map[string]bool
+		command   []string
+		want      []string
+	}{
+		{
+			name:      "rename and remove flags",
+			version:   "x86-1.24.0",
+			component: componentApiServer,
+			command:   []string{"kube-apiserver", "--insecure-port=0", "--service-account-api-audiences=a", "--secure-port=6443"},
+			want:      []string{"kube-apiserver", "--api-audiences=a", "--secure-port=6443"},
+		},
+		{
+			name:      "keep flags before removal",
+			version:   "x86-1.18.4",
+			component: componentApiServer,
+			command:   []string{"kube-apiserver", "--insecure-port=0"},
+			want:      []string{"kube-apiserver", "--insecure-port=0"},
+		},
+		{
+			name:      "merge default and spec gates",
+			version:   "x86-1.18.4",
+			component: componentControllerManager,
+			gates:     map[string]bool{"TopologyManager": true},
+			command:   []string{"kube-controller-manager", "--feature-gates=EndpointSlice=false"},
+			want:      []string{"kube-controller-manager", "--feature-gates=EndpointSlice=false,ServiceNodeExclusion=true,TopologyManager=true"},
+		},
+		{
+			name:      "drop removed and unknown gates",
+			version:   "x86-1.22.0",
+			component: componentControllerManager,
+			gates:     map[string]bool{"NewGate": true, "HPAScaleToZero": true},
+			command:   []string{"kube-controller-manager"},
+			want:      []string{"kube-controller-manager", "--feature-gates=HPAScaleToZero=true"},
+		},
+		{
+			name:      "drop locked default gates",
+			version:   "x86-1.21.0",
+			component: componentControllerManager,
+			command:   []string{"kube-controller-manager"},
+			want:      []string{"kube-controller-manager"},
+		},
+		{
+			name:      "spec overrides command gates",
+			version:   "x86-1.18.4",
+			component: componentScheduler,
+			gates:     map[string]bool{"EndpointSlice": true},
+			command:   []string{"kube-scheduler", "--feature-gates=EndpointSlice=false"},
+			want:      []string{"kube-scheduler", "--feature-gates=EndpointSlice=true"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testCluster()
+			c.Spec.FeatureGates = tt.gates
+			tpl := testPodTemplate(tt.command...)
+			applyFlagProfile(tt.version, tt.component, c, tpl)
+			if got := tpl.Spec.Containers[0].Command; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("command = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateFeatureGates(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		gates   map[string]bool
+		errs    int
+	}{
+		{name: "available gate", version: "x86-1.18.4", gates: map[string]bool{"EndpointSlice": false}},
+		{name: "unknown gate", version: "x86-1.18.4", gates: map[string]bool{"EndpointSlices": true}, errs: 1},
+		{name: "not yet added", version: "x86-1.15.0", gates: map[string]bool{"EndpointSlice": true}, errs: 1},
+		{name: "removed", version: "x86-1.22.0", gates: map[string]bool{"ServiceTopology": true}, errs: 1},
+		{name: "locked enabled", version: "x86-1.21.0", gates: map[string]bool{"EndpointSlice": true}},
+		{name: "locked disabled", version: "x86-1.21.0", gates: map[string]bool{"EndpointSlice": false}, errs: 1},
+		{name: "invalid version", version: "x86", errs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testCluster()
+			c.Spec.FeatureGates = tt.gates
+			if errs := validateFeatureGates(tt.version, c); len(errs) != tt.errs {
+				t.Errorf("validateFeatureGates() = %v, want %d errors", errs, tt.errs)
+			}
+		})
+	}
+}
+
+// 组件默认特性在所有支持的版本中都不能是已移除或已GA的特性
+func TestDefaultFeatureGates(t *testing.T) {
+	for minor := 13; minor <= 27; minor++ {
+		version := fmt.Sprintf("x86-1.%d.0", minor)
+		for component := range defaultFeatureGates {
+			tpl := testPodTemplate(component)
+			applyFlagProfile(version, component, testCluster(), tpl)
+			for _, arg := range tpl.Spec.Containers[0].Command[1:] {
+				for _, kv := range strings.Split(strings.TrimPrefix(arg, featureGatesFlag), ",") {
+					name := strings.SplitN(kv, "=", 2)[0]
+					if !featureGateAvailable(name, minor) || featureGateLocked(name, minor) {
+						t.Errorf("%s %s: default gate %s is removed or locked", version, component, name)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	tanxv1 "github.com/kok-stack/kok/api/v1"
+	"github.com/kok-stack/kok/controllers"
+	v12 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+)
+
+const (
+	frontProxyMountPath   = "/pki/front-proxy"
+	frontProxyClientName  = "front-proxy-client"
+	requestHeaderCAFlag   = "--requestheader-client-ca-file="
+	authenticationCMName  = "extension-apiserver-authentication"
+	requestHeaderCAKey    = "requestheader-client-ca-file"
+	metricsAPIServicePath = "/apis/apiregistration.k8s.io/v1/apiservices/v1beta1.metrics.k8s.io"
+)
+
+// apiserver作为front-proxy访问聚合apiserver(如metrics-server)时使用的证书
+func addFrontProxy(c *tanxv1.Cluster, t *v1.PodTemplateSpec) {
+	if c.Status.Init.FrontProxyPkiName == "" {
+		return
+	}
+	container := &t.Spec.Containers[0]
+	container.Command = append(container.Command,
+		fmt.Sprintf("%s%s/front-proxy-ca.pem", requestHeaderCAFlag, frontProxyMountPath),
+		fmt.Sprintf("--requestheader-allowed-names=%s", frontProxyClientName),
+		"--requestheader-extra-headers-prefix=X-Remote-Extra-",
+		"--requestheader-group-headers=X-Remote-Group",
+		"--requestheader-username-headers=X-Remote-User",
+		fmt.Sprintf("--proxy-client-cert-file=%s/front-proxy-client.pem", frontProxyMountPath),
+		fmt.Sprintf("--proxy-client-key-file=%s/front-proxy-client-key.pem", frontProxyMountPath),
+		//apiserver不在guest集群节点上,无法访问service的clusterIP,直接访问endpoint
+		"--enable-aggregator-routing=true",
+	)
+	mountFrontProxy(c, t)
+}
+
+// scheduler,controller-manager使用front-proxy CA校验经由apiserver转发的请求
+func addFrontProxyCA(c *tanxv1.Cluster, t *v1.PodTemplateSpec) {
+	if c.Status.Init.FrontProxyPkiName == "" {
+		return
+	}
+	container := &t.Spec.Containers[0]
+	for i, arg := range container.Command {
+		if strings.HasPrefix(arg, requestHeaderCAFlag) {
+			container.Command[i] = fmt.Sprintf("%s%s/front-proxy-ca.pem", requestHeaderCAFlag, frontProxyMountPath)
+		}
+	}
+	mountFrontProxy(c, t)
+}
+
+func mountFrontProxy(c *tanxv1.Cluster, t *v1.PodTemplateSpec) {
+	container := &t.Spec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{
+		Name:      "front-proxy-pki",
+		ReadOnly:  true,
+		MountPath: frontProxyMountPath,
+	})
+	t.Spec.Volumes = append(t.Spec.Volumes, v1.Volume{
+		Name: "front-proxy-pki",
+		VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{
+			SecretName: c.Status.Init.FrontProxyPkiName,
+		}},
+	})
+}
+
+// 检查guest集群聚合层是否可用:apiserver已发布requestheader配置,且已安装的metrics APIService为Available
+func probeAggregation(ctx context.Context, c *tanxv1.Cluster, cli client.Client) {
+	status := &c.Status.ApiServer.Aggregation
+	if c.Status.Init.FrontProxyPkiName == "" || !deploymentAvailable(c.Status.ApiServer.Status) {
+		return
+	}
+	guest, err := controllers.NewGuestClient(ctx, cli, c)
+	if err != nil {
+		status.Ready = false
+		status.Message = err.Error()
+		return
+	}
+	cm, err := guest.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get(authenticationCMName, metav1.GetOptions{})
+	if err != nil {
+		status.Ready = false
+		status.Message = err.Error()
+		return
+	}
+	if cm.Data[requestHeaderCAKey] == "" {
+		status.Ready = false
+		status.Message = fmt.Sprintf("%s not found in %s", requestHeaderCAKey, authenticationCMName)
+		return
+	}
+	status.Ready = true
+
+	data, err := guest.Discovery().RESTClient().Get().AbsPath(metricsAPIServicePath).DoRaw()
+	if err != nil {
+		status.MetricsAvailable = false
+		if errors.IsNotFound(err) {
+			status.Message = "metrics-server not installed"
+		} else {
+			status.Message = err.Error()
+		}
+		return
+	}
+	apiService := &struct {
+		Status struct {
+			Conditions []struct {
+				Type    string `json:"type"`
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			} `json:"conditions"`
+		} `json:"status"`
+	}{}
+	if err := json.Unmarshal(data, apiService); err != nil {
+		status.MetricsAvailable = false
+		status.Message = err.Error()
+		return
+	}
+	status.MetricsAvailable = false
+	status.Message = "metrics APIService not available"
+	for _, condition := range apiService.Status.Conditions {
+		if condition.Type == "Available" {
+			status.MetricsAvailable = condition.Status == string(v1.ConditionTrue)
+			status.Message = condition.Message
+		}
+	}
+}
+
+func deploymentAvailable(status v12.DeploymentStatus) bool {
+	for _, condition := range status.Conditions {
+		if v12.DeploymentAvailable == condition.Type && v1.ConditionTrue == condition.Status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package cluster
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	tanxv1 "github.com/kok-stack/kok/api/v1"
+	v12 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestAddFrontProxy(t *testing.T) {
+	tests := []struct {
+		name    string
+		pkiName string
+		add     func(c *tanxv1.Cluster, t *v1.PodTemplateSpec)
+		command []string
+		want    []string
+	}{
+		{name: "apiserver without pki", add: addFrontProxy, command: []string{"kube-apiserver"}, want: []string{"kube-apiserver"}},
+		{
+			name:    "apiserver",
+			pkiName: "c-front-proxy",
+			add:     addFrontProxy,
+			command: []string{"kube-apiserver"},
+			want: []string{
+				"kube-apiserver",
+				"--requestheader-client-ca-file=/pki/front-proxy/front-proxy-ca.pem",
+				"--requestheader-allowed-names=front-proxy-client",
+				"--requestheader-extra-headers-prefix=X-Remote-Extra-",
+				"--requestheader-group-headers=X-Remote-Group",
+				"--requestheader-username-headers=X-Remote-User",
+				"--proxy-client-cert-file=/pki/front-proxy/front-proxy-client.pem",
+				"--proxy-client-key-file=/pki/front-proxy/front-proxy-client-key.pem",
+				"--enable-aggregator-routing=true",
+			},
+		},
+		{
+			name:    "controller-manager without pki",
+			add:     addFrontProxyCA,
+			command: []string{"kube-controller-manager", "--requestheader-client-ca-file=/pki/ca/ca.pem"},
+			want:    []string{"kube-controller-manager", "--requestheader-client-ca-file=/pki/ca/ca.pem"},
+		},
+		{
+			//只替换已有的flag
+			name:    "controller-manager",
+			pkiName: "c-front-proxy",
+			add:     addFrontProxyCA,
+			command: []string{"kube-controller-manager", "--requestheader-client-ca-file=/pki/ca/ca.pem"},
+			want:    []string{"kube-controller-manager", "--requestheader-client-ca-file=/pki/front-proxy/front-proxy-ca.pem"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testCluster()
+			c.Status.Init.FrontProxyPkiName = tt.pkiName
+			tpl := testPodTemplate(tt.command...)
+			tt.add(c, tpl)
+			if got := tpl.Spec.Containers[0].Command; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("command = %v, want %v", got, tt.want)
+			}
+			mounted := len(tpl.Spec.Volumes) == 1 && len(tpl.Spec.Containers[0].VolumeMounts) == 1
+			if mounted != (tt.pkiName != "") {
+				t.Fatalf("volumes = %+v, mounts = %+v", tpl.Spec.Volumes, tpl.Spec.Containers[0].VolumeMounts)
+			}
+			if mounted && (tpl.Spec.Volumes[0].Secret.SecretName != tt.pkiName || tpl.Spec.Containers[0].VolumeMounts[0].MountPath != frontProxyMountPath) {
+				t.Errorf("front-proxy pki mounted as %+v, %+v", tpl.Spec.Volumes[0], tpl.Spec.Containers[0].VolumeMounts[0])
+			}
+		})
+	}
+}
+
+func TestProbeAggregationSkipped(t *testing.T) {
+	available := v12.DeploymentStatus{Conditions: []v12.DeploymentCondition{{Type: v12.DeploymentAvailable, Status: v1.ConditionTrue}}}
+	tests := []struct {
+		name    string
+		pkiName string
+		status  v12.DeploymentStatus
+	}{
+		{name: "without pki", status: available},
+		{name: "apiserver not available", pkiName: "c-front-proxy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testCluster()
+			c.Status.Init.FrontProxyPkiName = tt.pkiName
+			c.Status.ApiServer.Status = tt.status
+			c.Status.ApiServer.Aggregation.Message = "last"
+			//不访问guest集群,client为空时调用会panic
+			probeAggregation(context.Background(), c, nil)
+			if a := c.Status.ApiServer.Aggregation; a.Ready || a.Message != "last" {
+				t.Errorf("aggregation status changed: %+v", a)
+			}
+		})
+	}
+}
@@ -10,10 +10,12 @@ import (
 	v13 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	"math/big"
 	"net"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
 )
 
 func NewInitModules(cfg *controllers.InitConfig) {
@@ -82,6 +84,9 @@ func NewInitModules(cfg *controllers.InitConfig) {
 							}, {
 								Name:  "NODE_CONFIG_NAME",
 								Value: getNodeConfigName(c),
+							}, {
+								Name:  "FRONT_PROXY_PKI_NAME",
+								Value: getFrontProxyPkiName(c),
 							}, {
 								Name:  "CLUSTER_DOMAIN",
 								Value: c.Spec.ClusterDomain,
@@ -134,25 +139,43 @@ func NewInitModules(cfg *controllers.InitConfig) {
 					c.Status.Init.NodeConfigName = env.Value
 					continue
 				}
+				if env.Name == "FRONT_PROXY_PKI_NAME" {
+					c.Status.Init.FrontProxyPkiName = env.Value
+					continue
+				}
 			}
 
 			return false, now
 		},
 		Del: func(ctx context.Context, c *tanxv1.Cluster, client client.Client) error {
-			var err error
-			nameFunc := []func(cluster *tanxv1.Cluster) string{getCAPkiName, getEtcdPkiClientName, getEtcdPkiServerName, getEtcdPkiPeerName, getServerName, getClientName, getNodeConfigName, getAdminConfigName}
-			for _, namef := range nameFunc {
-				err = client.Delete(ctx, &v12.Secret{
-					ObjectMeta: metav1.ObjectMeta{Name: namef(c), Namespace: c.Namespace},
+			for _, name := range initSecretNames(c) {
+				err := client.Delete(ctx, &v12.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: c.Namespace},
 				})
-				if err != nil && errors.IsNotFound(err) {
-					return nil
-				}
-				if err != nil {
+				if err != nil && !errors.IsNotFound(err) {
 					return err
 				}
 			}
-			return err
+			return nil
+		},
+		Gone: func(ctx context.Context, c *tanxv1.Cluster, cli client.Client) (bool, error) {
+			for _, name := range initSecretNames(c) {
+				err := cli.Get(ctx, types.NamespacedName{Namespace: c.Namespace, Name: name}, &v12.Secret{})
+				if err == nil {
+					return false, nil
+				}
+				if !errors.IsNotFound(err) {
+					return false, err
+				}
+			}
+			return true, nil
+		},
+		Retain: true,
+		Recreate: func(c *tanxv1.Cluster, now controllers.Object) bool {
+			return jobFailed(now.(*v1.Job).Status) && controllers.RemediateJob(c, now.GetName())
+		},
+		RequeueAfter: func(c *tanxv1.Cluster) time.Duration {
+			return controllers.FailedJobRequeue(c, jobFailed(c.Status.Init.Status))
 		},
 		Next: func(c *tanxv1.Cluster) bool {
 			for _, condition := range c.Status.Init.Status.Conditions {
@@ -266,6 +289,7 @@ func NewInitModules(cfg *controllers.InitConfig) {
 			if r.Spec.KubeProxySpec.BindAddress == "" {
 				allErrs = append(allErrs, field.Invalid(field.NewPath("spec.kubeProxySpec.bindAddress"), r.Spec.KubeProxySpec.BindAddress, "不能为空"))
 			}
+			allErrs = append(allErrs, validateRemediation(r.Spec.Remediation)...)
 			return allErrs
 		},
 		ValidateUpdateModule: func(now *tanxv1.Cluster, old *tanxv1.Cluster) field.ErrorList {
@@ -291,6 +315,7 @@ func NewInitModules(cfg *controllers.InitConfig) {
 			if now.Spec.KubeProxySpec.BindAddress != old.Spec.KubeProxySpec.BindAddress {
 				allErrs = append(allErrs, field.Invalid(field.NewPath("spec.kubeProxySpec.bindAddress"), now.Spec.KubeProxySpec.BindAddress, "不允许修改"))
 			}
+			allErrs = append(allErrs, validateRemediation(now.Spec.Remediation)...)
 			return allErrs
 		},
 	}
@@ -302,6 +327,31 @@ func NewInitModules(cfg *controllers.InitConfig) {
 	controllers.AddModules(cfg.Version, initModule)
 }
 
+func validateRemediation(r tanxv1.ClusterRemediationSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	path := field.NewPath("spec.remediation")
+	if r.CrashLoopRestartThreshold < 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("crashLoopRestartThreshold"), r.CrashLoopRestartThreshold, "不能<0"))
+	}
+	if r.EtcdUnhealthyTimeout != nil && r.EtcdUnhealthyTimeout.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("etcdUnhealthyTimeout"), r.EtcdUnhealthyTimeout.Duration.String(), "不能<0"))
+	}
+	if r.MinInterval != nil && r.MinInterval.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("minInterval"), r.MinInterval.Duration.String(), "不能<0"))
+	}
+	return allErrs
+}
+
+// initSecretNames init job生成的PKI及kubeconfig secrets
+func initSecretNames(c *tanxv1.Cluster) []string {
+	nameFunc := []func(cluster *tanxv1.Cluster) string{getCAPkiName, getEtcdPkiClientName, getEtcdPkiServerName, getEtcdPkiPeerName, getServerName, getClientName, getNodeConfigName, getAdminConfigName, getFrontProxyPkiName}
+	names := make([]string, len(nameFunc))
+	for i, namef := range nameFunc {
+		names[i] = namef(c)
+	}
+	return names
+}
+
 func getEtcdSvcClientName(c *tanxv1.Cluster) string {
 	return fmt.Sprintf("%s-etcd-client", c.Name)
 }
@@ -349,3 +399,7 @@ func getNodeConfigName(c *tanxv1.Cluster) string {
 func getAdminConfigName(c *tanxv1.Cluster) string {
 	return fmt.Sprintf("%s-admin-config", c.Name)
 }
+
+func getFrontProxyPkiName(c *tanxv1.Cluster) string {
+	return fmt.Sprintf("%s-front-proxy-pki", c.Name)
+}
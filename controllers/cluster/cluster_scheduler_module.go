@@ -125,6 +125,8 @@ func NewSchedulerModules(cfg *controllers.InitConfig) {
 					},
 				},
 			}
+			addFrontProxyCA(c, &out.Spec.Template)
+			applyFlagProfile(cfg.Version, componentScheduler, c, &out.Spec.Template)
 			return out
 		},
 		SetStatus: func(c *tanxv1.Cluster, target, now controllers.Object) (bool, controllers.Object) {
@@ -140,6 +142,9 @@ func NewSchedulerModules(cfg *controllers.InitConfig) {
 			}
 			return false, n
 		},
+		Next: func(c *tanxv1.Cluster) bool {
+			return deploymentAvailable(c.Status.Scheduler.Status)
+		},
 		SetDefault: func(r *tanxv1.Cluster) {
 			if r.Spec.SchedulerSpec.Image == "" {
 				r.Spec.SchedulerSpec.Image = cfg.SchedulerImage
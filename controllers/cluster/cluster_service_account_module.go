@@ -0,0 +1,304 @@
+package cluster
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	tanxv1 "github.com/kok-stack/kok/api/v1"
+	"github.com/kok-stack/kok/controllers"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	serviceAccountMountPath          = "/pki/service-account"
+	serviceAccountPrivateKey         = "sa.key"
+	serviceAccountPublicKey          = "sa.pub"
+	serviceAccountHashAnnotation     = "kok.tanx/service-account-key-hash"
+	serviceAccountRotationAnnotation = "kok.tanx/service-account-rotation"
+	serviceAccountExpirePrefix       = "expire.kok.tanx/"
+	//升级前创建的集群由kubernetes-server-key签发token,首次轮换前继续信任
+	serviceAccountLegacyAnnotation   = "kok.tanx/service-account-legacy-key"
+	legacyServiceAccountKey          = "legacy"
+	legacyServiceAccountKeyFile      = "/pki/server/kubernetes-server-key.pem"
+	defaultServiceAccountIssuer      = "https://kubernetes.default.svc"
+	defaultServiceAccountGracePeriod = time.Hour * 24
+)
+
+func NewServiceAccountModules(cfg *controllers.InitConfig) {
+	var serviceAccountKey = &controllers.Module{
+		GetObj: func() controllers.Object {
+			return &v1.Secret{}
+		},
+		Render: func(c *tanxv1.Cluster) controllers.Object {
+			return &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      getServiceAccountKeyName(c),
+					Namespace: c.Namespace,
+					Annotations: map[string]string{
+						serviceAccountRotationAnnotation: strconv.FormatInt(c.Spec.ApiServerSpec.ServiceAccount.RotationGeneration, 10),
+					},
+				},
+			}
+		},
+		//密钥只在创建时生成,已创建的secret缺少密钥时由nextServiceAccountKeys补充
+		BeforeCreate: func(c *tanxv1.Cluster, obj controllers.Object) error {
+			secret := obj.(*v1.Secret)
+			secret.Data = map[string][]byte{}
+			if err := newServiceAccountKey(secret.Data); err != nil {
+				return err
+			}
+			//apiserver已经运行过,guest中已有旧密钥签发的token
+			if c.Status.ApiServer.Name != "" {
+				secret.Annotations[serviceAccountLegacyAnnotation] = "true"
+			}
+			return nil
+		},
+		SetStatus: func(c *tanxv1.Cluster, target, now controllers.Object) (bool, controllers.Object) {
+			secret := now.(*v1.Secret)
+			changed := nextServiceAccountKeys(c, secret, time.Now())
+			status := &c.Status.ApiServer.ServiceAccount
+			status.SecretName = secret.Name
+			status.ObservedRotation, _ = strconv.ParseInt(secret.Annotations[serviceAccountRotationAnnotation], 10, 64)
+			status.RetiredKeys = retiredServiceAccountKeys(secret)
+			status.LegacyKey = secret.Annotations[serviceAccountLegacyAnnotation] == "true"
+			status.KeyHash = hashServiceAccountKeys(secret)
+			return changed, secret
+		},
+		Retain: true,
+		RequeueAfter: func(c *tanxv1.Cluster) time.Duration {
+			var min time.Duration
+			for _, key := range c.Status.ApiServer.ServiceAccount.RetiredKeys {
+				d := time.Until(key.ExpirationTime.Time)
+				if d <= 0 {
+					d = time.Second
+				}
+				if min == 0 || d < min {
+					min = d
+				}
+			}
+			return min
+		},
+		SetDefault: func(r *tanxv1.Cluster) {
+			defaultServiceAccount(&r.Spec.ApiServerSpec.ServiceAccount)
+		},
+		ValidateCreateModule: func(r *tanxv1.Cluster) field.ErrorList {
+			return validateServiceAccount(r.Spec.ApiServerSpec.ServiceAccount)
+		},
+		ValidateUpdateModule: func(now *tanxv1.Cluster, old *tanxv1.Cluster) field.ErrorList {
+			allErrs := validateServiceAccount(now.Spec.ApiServerSpec.ServiceAccount)
+			n := now.Spec.ApiServerSpec.ServiceAccount
+			o := old.Spec.ApiServerSpec.ServiceAccount
+			if o.Issuer != "" && n.Issuer != o.Issuer {
+				allErrs = append(allErrs, field.Invalid(field.NewPath("spec.apiServer.serviceAccount.issuer"), n.Issuer, "不允许修改"))
+			}
+			if n.RotationGeneration < o.RotationGeneration {
+				allErrs = append(allErrs, field.Invalid(field.NewPath("spec.apiServer.serviceAccount.rotationGeneration"), n.RotationGeneration, "不允许减小"))
+			}
+			return allErrs
+		},
+	}
+
+	var serviceAccountModule = &controllers.Module{
+		Order: 26,
+		Name:  "service-account-key",
+		Sub:   []*controllers.Module{serviceAccountKey},
+	}
+	controllers.AddModules(cfg.Version, serviceAccountModule)
+}
+
+// defaultServiceAccount webhook及控制器共用的默认值,webhook之前创建的集群这些字段为空
+func defaultServiceAccount(sa *tanxv1.ClusterServiceAccountSpec) {
+	if sa.Issuer == "" {
+		sa.Issuer = defaultServiceAccountIssuer
+	}
+	if len(sa.Audiences) == 0 {
+		sa.Audiences = []string{sa.Issuer}
+	}
+	if sa.GracePeriod == nil {
+		sa.GracePeriod = &metav1.Duration{Duration: defaultServiceAccountGracePeriod}
+	}
+}
+
+func validateServiceAccount(sa tanxv1.ClusterServiceAccountSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	path := field.NewPath("spec.apiServer.serviceAccount")
+	if u, err := url.Parse(sa.Issuer); err != nil || u.Scheme != "https" {
+		allErrs = append(allErrs, field.Invalid(path.Child("issuer"), sa.Issuer, "必须为https地址"))
+	}
+	if sa.JWKSURI != "" {
+		if u, err := url.Parse(sa.JWKSURI); err != nil || u.Scheme != "https" {
+			allErrs = append(allErrs, field.Invalid(path.Child("jwksURI"), sa.JWKSURI, "必须为https地址"))
+		}
+	}
+	if len(sa.Audiences) == 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("audiences"), sa.Audiences, "不能为空"))
+	}
+	if sa.RotationGeneration < 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("rotationGeneration"), sa.RotationGeneration, "不能<0"))
+	}
+	if sa.GracePeriod != nil && sa.GracePeriod.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("gracePeriod"), sa.GracePeriod.Duration.String(), "不能<0"))
+	}
+	return allErrs
+}
+
+// 轮换时旧公钥以sa-<rotation>.pub保留在secret中,过期时间记录在annotation,宽限期内apiserver仍可校验旧token
+func nextServiceAccountKeys(c *tanxv1.Cluster, secret *v1.Secret, now time.Time) bool {
+	spec := c.Spec.ApiServerSpec.ServiceAccount
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	changed := false
+	if len(secret.Data[serviceAccountPrivateKey]) == 0 {
+		if err := newServiceAccountKey(secret.Data); err != nil {
+			return false
+		}
+		secret.Annotations[serviceAccountRotationAnnotation] = strconv.FormatInt(spec.RotationGeneration, 10)
+		changed = true
+	}
+	observed, _ := strconv.ParseInt(secret.Annotations[serviceAccountRotationAnnotation], 10, 64)
+	if spec.RotationGeneration > observed {
+		retired := fmt.Sprintf("sa-%d.pub", observed)
+		old := secret.Data[serviceAccountPublicKey]
+		if err := newServiceAccountKey(secret.Data); err != nil {
+			return changed
+		}
+		grace := defaultServiceAccountGracePeriod
+		if spec.GracePeriod != nil {
+			grace = spec.GracePeriod.Duration
+		}
+		secret.Data[retired] = old
+		secret.Annotations[serviceAccountExpirePrefix+retired] = now.Add(grace).UTC().Format(time.RFC3339)
+		//旧集群的kubernetes-server-key与本次轮换下的公钥一起在宽限期后失效
+		if secret.Annotations[serviceAccountLegacyAnnotation] == "true" {
+			delete(secret.Annotations, serviceAccountLegacyAnnotation)
+			secret.Annotations[serviceAccountExpirePrefix+legacyServiceAccountKey] = now.Add(grace).UTC().Format(time.RFC3339)
+		}
+		secret.Annotations[serviceAccountRotationAnnotation] = strconv.FormatInt(spec.RotationGeneration, 10)
+		changed = true
+	}
+	for _, key := range retiredServiceAccountKeys(secret) {
+		if now.Before(key.ExpirationTime.Time) {
+			continue
+		}
+		delete(secret.Data, key.Name)
+		delete(secret.Annotations, serviceAccountExpirePrefix+key.Name)
+		changed = true
+	}
+	return changed
+}
+
+func retiredServiceAccountKeys(secret *v1.Secret) []tanxv1.ClusterRetiredKey {
+	var keys []tanxv1.ClusterRetiredKey
+	for k, v := range secret.Annotations {
+		if !strings.HasPrefix(k, serviceAccountExpirePrefix) {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, tanxv1.ClusterRetiredKey{
+			Name:           strings.TrimPrefix(k, serviceAccountExpirePrefix),
+			ExpirationTime: metav1.NewTime(t),
+		})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Name < keys[j].Name
+	})
+	return keys
+}
+
+func newServiceAccountKey(data map[string][]byte) error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return err
+	}
+	data[serviceAccountPrivateKey] = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	data[serviceAccountPublicKey] = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+	return nil
+}
+
+func hashServiceAccountKeys(secret *v1.Secret) string {
+	data, _ := json.Marshal(secret.Data)
+	return hashData(data)
+}
+
+// apiserver使用当前私钥签发token,并用当前及宽限期内的旧公钥校验token
+func addServiceAccount(c *tanxv1.Cluster, t *v1.PodTemplateSpec) {
+	sa := c.Spec.ApiServerSpec.ServiceAccount
+	defaultServiceAccount(&sa)
+	status := c.Status.ApiServer.ServiceAccount
+	container := &t.Spec.Containers[0]
+	container.Command = append(container.Command,
+		fmt.Sprintf("--service-account-key-file=%s/%s", serviceAccountMountPath, serviceAccountPublicKey),
+	)
+	if status.LegacyKey {
+		container.Command = append(container.Command, fmt.Sprintf("--service-account-key-file=%s", legacyServiceAccountKeyFile))
+	}
+	for _, key := range status.RetiredKeys {
+		file := fmt.Sprintf("%s/%s", serviceAccountMountPath, key.Name)
+		if key.Name == legacyServiceAccountKey {
+			file = legacyServiceAccountKeyFile
+		}
+		container.Command = append(container.Command, fmt.Sprintf("--service-account-key-file=%s", file))
+	}
+	container.Command = append(container.Command,
+		fmt.Sprintf("--service-account-signing-key-file=%s/%s", serviceAccountMountPath, serviceAccountPrivateKey),
+		fmt.Sprintf("--service-account-issuer=%s", sa.Issuer),
+		fmt.Sprintf("--api-audiences=%s", strings.Join(sa.Audiences, ",")),
+	)
+	if sa.JWKSURI != "" {
+		container.Command = append(container.Command, fmt.Sprintf("--service-account-jwks-uri=%s", sa.JWKSURI))
+	}
+	mountServiceAccountKey(c, t)
+}
+
+// controller-manager使用当前私钥为serviceaccount签发token
+func addServiceAccountSigner(c *tanxv1.Cluster, t *v1.PodTemplateSpec) {
+	container := &t.Spec.Containers[0]
+	container.Command = append(container.Command,
+		fmt.Sprintf("--service-account-private-key-file=%s/%s", serviceAccountMountPath, serviceAccountPrivateKey),
+	)
+	mountServiceAccountKey(c, t)
+}
+
+func mountServiceAccountKey(c *tanxv1.Cluster, t *v1.PodTemplateSpec) {
+	container := &t.Spec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{
+		Name:      "service-account-key",
+		ReadOnly:  true,
+		MountPath: serviceAccountMountPath,
+	})
+	t.Spec.Volumes = append(t.Spec.Volumes, v1.Volume{
+		Name: "service-account-key",
+		VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{
+			SecretName: getServiceAccountKeyName(c),
+		}},
+	})
+	if t.Annotations == nil {
+		t.Annotations = map[string]string{}
+	}
+	t.Annotations[serviceAccountHashAnnotation] = c.Status.ApiServer.ServiceAccount.KeyHash
+}
+
+func getServiceAccountKeyName(c *tanxv1.Cluster) string {
+	return fmt.Sprintf("%s-service-account-key", c.Name)
+}
@@ -0,0 +1,137 @@
+package cluster
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tanxv1 "github.com/kok-stack/kok/api/v1"
+	"github.com/kok-stack/kok/controllers"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNextServiceAccountKeys(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	rotated := func(rotation int64) *tanxv1.Cluster {
+		c := testCluster()
+		c.Spec.ApiServerSpec.ServiceAccount.RotationGeneration = rotation
+		return c
+	}
+
+	t.Run("generate missing key", func(t *testing.T) {
+		secret := &v1.Secret{}
+		if !nextServiceAccountKeys(rotated(0), secret, now) {
+			t.Fatal("expected change")
+		}
+		if len(secret.Data[serviceAccountPrivateKey]) == 0 || len(secret.Data[serviceAccountPublicKey]) == 0 {
+			t.Fatal("key not generated")
+		}
+		if nextServiceAccountKeys(rotated(0), secret, now) {
+			t.Fatal("expected no change without rotation")
+		}
+	})
+
+	t.Run("rotation retires old public key", func(t *testing.T) {
+		secret := &v1.Secret{}
+		nextServiceAccountKeys(rotated(0), secret, now)
+		oldPub := string(secret.Data[serviceAccountPublicKey])
+		if !nextServiceAccountKeys(rotated(1), secret, now) {
+			t.Fatal("expected change")
+		}
+		if string(secret.Data[serviceAccountPublicKey]) == oldPub {
+			t.Fatal("key not rotated")
+		}
+		if string(secret.Data["sa-0.pub"]) != oldPub {
+			t.Fatal("old public key not retained")
+		}
+		keys := retiredServiceAccountKeys(secret)
+		if len(keys) != 1 || keys[0].Name != "sa-0.pub" || !keys[0].ExpirationTime.Time.Equal(now.Add(time.Hour)) {
+			t.Fatalf("unexpected retired keys %v", keys)
+		}
+		if secret.Annotations[serviceAccountRotationAnnotation] != "1" {
+			t.Fatalf("rotation annotation = %s", secret.Annotations[serviceAccountRotationAnnotation])
+		}
+
+		//宽限期后删除旧公钥
+		if !nextServiceAccountKeys(rotated(1), secret, now.Add(2*time.Hour)) {
+			t.Fatal("expected change")
+		}
+		if _, ok := secret.Data["sa-0.pub"]; ok {
+			t.Fatal("expired key not removed")
+		}
+		if keys := retiredServiceAccountKeys(secret); len(keys) != 0 {
+			t.Fatalf("unexpected retired keys %v", keys)
+		}
+	})
+
+	t.Run("legacy key retires on first rotation", func(t *testing.T) {
+		secret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{serviceAccountLegacyAnnotation: "true"}}}
+		nextServiceAccountKeys(rotated(0), secret, now)
+		if secret.Annotations[serviceAccountLegacyAnnotation] != "true" {
+			t.Fatal("legacy key dropped without rotation")
+		}
+		nextServiceAccountKeys(rotated(1), secret, now)
+		if _, ok := secret.Annotations[serviceAccountLegacyAnnotation]; ok {
+			t.Fatal("legacy annotation not removed")
+		}
+		keys := retiredServiceAccountKeys(secret)
+		if len(keys) != 2 || keys[0].Name != legacyServiceAccountKey {
+			t.Fatalf("unexpected retired keys %v", keys)
+		}
+		nextServiceAccountKeys(rotated(1), secret, now.Add(2*time.Hour))
+		if keys := retiredServiceAccountKeys(secret); len(keys) != 0 {
+			t.Fatalf("unexpected retired keys %v", keys)
+		}
+	})
+}
+
+func TestAddServiceAccount(t *testing.T) {
+	c := testCluster()
+	c.Status.ApiServer.ServiceAccount.LegacyKey = true
+	c.Status.ApiServer.ServiceAccount.RetiredKeys = []tanxv1.ClusterRetiredKey{{Name: "sa-0.pub"}}
+	tpl := testPodTemplate()
+	addServiceAccount(c, tpl)
+	cmd := strings.Join(tpl.Spec.Containers[0].Command, " ")
+	for _, flag := range []string{
+		"--service-account-issuer=" + defaultServiceAccountIssuer,
+		"--api-audiences=" + defaultServiceAccountIssuer,
+		"--service-account-key-file=" + legacyServiceAccountKeyFile,
+		"--service-account-key-file=" + serviceAccountMountPath + "/sa-0.pub",
+	} {
+		if !strings.Contains(cmd, flag) {
+			t.Errorf("missing %s in %s", flag, cmd)
+		}
+	}
+}
+
+func TestServiceAccountKeyModule(t *testing.T) {
+	NewServiceAccountModules(&controllers.InitConfig{Version: "test-service-account"})
+	m := controllers.VersionsModules["test-service-account"][0].Sub[0]
+	c := testCluster()
+
+	//Render不生成密钥
+	if secret := m.Render(c).(*v1.Secret); secret.Data != nil {
+		t.Fatalf("Render() generated key data")
+	}
+	secret := m.Render(c)
+	if err := m.BeforeCreate(c, secret); err != nil {
+		t.Fatal(err)
+	}
+	data := secret.(*v1.Secret).Data
+	if len(data[serviceAccountPrivateKey]) == 0 || len(data[serviceAccountPublicKey]) == 0 {
+		t.Fatal("BeforeCreate() did not generate key")
+	}
+	if _, ok := secret.GetAnnotations()[serviceAccountLegacyAnnotation]; ok {
+		t.Error("new cluster marked legacy")
+	}
+
+	c.Status.ApiServer.Name = "c-apiserver"
+	secret = m.Render(c)
+	if err := m.BeforeCreate(c, secret); err != nil {
+		t.Fatal(err)
+	}
+	if secret.GetAnnotations()[serviceAccountLegacyAnnotation] != "true" {
+		t.Error("existing apiserver not marked legacy")
+	}
+}
@@ -0,0 +1,23 @@
+package cluster
+
+import (
+	"time"
+
+	tanxv1 "github.com/kok-stack/kok/api/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testCluster 各模块测试共用的集群,默认值与webhook一致,按需修改spec,status
+func testCluster() *tanxv1.Cluster {
+	c := &tanxv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "test"}}
+	c.Spec.ClusterVersion = "x86-1.18.4"
+	defaultServiceAccount(&c.Spec.ApiServerSpec.ServiceAccount)
+	c.Spec.ApiServerSpec.ServiceAccount.GracePeriod = &metav1.Duration{Duration: time.Hour}
+	return c
+}
+
+// testPodTemplate 只有一个容器的pod模板
+func testPodTemplate(command ...string) *v1.PodTemplateSpec {
+	return &v1.PodTemplateSpec{Spec: v1.PodSpec{Containers: []v1.Container{{Command: command}}}}
+}
@@ -30,6 +30,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	clusterv1 "github.com/kok-stack/kok/api/v1"
 )
@@ -55,35 +56,108 @@ func (r *ClusterReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 	moduleContext := NewModuleContext(ctx, cs, rl, r)
+	//删除优先于暂停,避免暂停的Cluster无法删除
 	if !cs.ObjectMeta.DeletionTimestamp.IsZero() {
 		return deleteCluster(moduleContext)
 	}
+	if _, ok := cs.GetAnnotations()[clusterv1.PausedAnnotation]; ok {
+		return observeCluster(moduleContext)
+	}
 
 	return ReconcileCluster(moduleContext)
 }
 
 func deleteCluster(ctx *ModuleContext) (ctrl.Result, error) {
+	if !containsString(ctx.GetFinalizers(), FinalizerName) {
+		return ctrl.Result{}, nil
+	}
 	version := ctx.Spec.ClusterVersion
 	modules, ok := VersionsModules[version]
 	if !ok {
 		return ctrl.Result{}, fmt.Errorf("not support version %s", version)
 	}
+	//Retain策略保留集群数据,插件不做uninstall
+	if ctx.Spec.DeletionPolicy != clusterv1.DeletionPolicyRetain {
+		done, err := deleteClusterPlugins(ctx)
+		if err != nil {
+			ctx.Info("delete cluster plugins error", "error", err)
+			return ctrl.Result{}, err
+		}
+		if !done {
+			ctx.Info("waiting for cluster plugins uninstall")
+			ctx.Status.Deletion.Module = "plugins"
+			if err := PatchStatusAndFinalizers(ctx, ctx.Client, ctx.Cluster, ctx.Original); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: deletionCheckPeriod}, nil
+		}
+	}
+	switch ctx.Spec.DeletionPolicy {
+	case clusterv1.DeletionPolicyRetain:
+		if err := retainClusterResources(ctx); err != nil {
+			ctx.Info("retain resources error", "error", err)
+			return ctrl.Result{}, err
+		}
+	case clusterv1.DeletionPolicySnapshot:
+		if _, ok := ctx.GetAnnotations()[clusterv1.SkipSnapshotAnnotation]; ok {
+			ctx.Info("skip etcd snapshot")
+			break
+		}
+		done, err := snapshotEtcd(ctx)
+		if err != nil {
+			ctx.Recorder.Event(ctx, v13.EventTypeWarning, "SnapshotError", err.Error())
+			ctx.Info("snapshot etcd error", "error", err)
+		}
+		//快照job失败后不会再变化,等待添加annotation后继续删除
+		if err != nil && jobCondition(ctx.Status.Deletion.SnapshotStatus, v12.JobFailed) {
+			clusterv1.SetCondition(&ctx.Status.Conditions, clusterv1.ConditionFailed, v13.ConditionTrue, "SnapshotFailed",
+				fmt.Sprintf("%v, annotate %s to delete without snapshot", err, clusterv1.SkipSnapshotAnnotation))
+			return ctrl.Result{}, PatchStatusAndFinalizers(ctx, ctx.Client, ctx.Cluster, ctx.Original)
+		}
+		if !done {
+			if err := PatchStatusAndFinalizers(ctx, ctx.Client, ctx.Cluster, ctx.Original); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: snapshotCheckPeriod}, nil
+		}
+	}
+	//按依赖的相反顺序删除,上一个模块的对象确认消失后再删除下一个
+	status := &ctx.Status.Deletion
 	total := len(modules)
-	for index, module := range modules {
+	for index := total - 1; index >= 0; index-- {
+		module := modules[index]
 		moduleName := module.Name
-		moduleString := fmt.Sprintf("[%v/%v]%s ", index+1, total, moduleName)
+		moduleString := fmt.Sprintf("[%v/%v]%s ", total-index, total, moduleName)
+		if containsString(status.DeletedModules, moduleName) {
+			continue
+		}
+		status.Module = moduleString
 		if err := module.Delete(ctx); err != nil {
 			ctx.Recorder.Event(ctx, v13.EventTypeWarning, "ModuleDeleteError", fmt.Sprintf("[%s] Error:%v", moduleName, err))
 			ctx.Info(moduleString+"module Del error", "error", err)
 			return ctrl.Result{}, err
 		}
+		deleted, err := module.Deleted(ctx)
+		if err != nil {
+			ctx.Info(moduleString+"check module deleted error", "error", err)
+			return ctrl.Result{}, err
+		}
+		if !deleted {
+			ctx.Info(moduleString + "waiting for module objects to disappear")
+			if err := PatchStatusAndFinalizers(ctx, ctx.Client, ctx.Cluster, ctx.Original); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: deletionCheckPeriod}, nil
+		}
+		status.DeletedModules = append(status.DeletedModules, moduleName)
 		ctx.Info(moduleString + "module Del success")
 	}
+	status.Module = ""
 
-	ctx.SetFinalizers([]string{})
-	ctx.Info("remove Finalizers...")
-	if err := ctx.Update(ctx, ctx.Cluster); err != nil {
-		ctx.Info("remove Finalizers error", "error", err)
+	controllerutil.RemoveFinalizer(ctx.Cluster, FinalizerName)
+	ctx.Info("remove Finalizer...")
+	if err := PatchStatusAndFinalizers(ctx, ctx.Client, ctx.Cluster, ctx.Original); err != nil {
+		ctx.Info("remove Finalizer error", "error", err)
 		return ctrl.Result{}, err
 	}
 	ctx.Info("Del cluster finish", "name", ctx.Name, "namespace", ctx.Namespace)
@@ -91,7 +165,31 @@ func deleteCluster(ctx *ModuleContext) (ctrl.Result, error) {
 	return ctrl.Result{}, nil
 }
 
-var retryDuration = time.Second * 1
+// observeCluster 暂停时只读取各模块的对象刷新status,不创建、更新或删除任何资源
+func observeCluster(ctx *ModuleContext) (ctrl.Result, error) {
+	version := ctx.Spec.ClusterVersion
+	modules, ok := VersionsModules[version]
+	if !ok {
+		return ctrl.Result{}, fmt.Errorf("not support version %s", version)
+	}
+	ctx.Info("Cluster paused, observe only", "version", version)
+	for _, module := range modules {
+		if err := module.Observe(ctx); err != nil {
+			ctx.Info("observe module error", "module", module.Name, "error", err)
+			return ctrl.Result{}, err
+		}
+	}
+	clusterv1.SetCondition(&ctx.Status.Conditions, clusterv1.ConditionPaused, v13.ConditionTrue, "Paused", "")
+	if err := PatchStatusAndFinalizers(ctx, ctx.Client, ctx.Cluster, ctx.Original); err != nil {
+		ctx.Info("update Cluster(crd) status error", "error", err)
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+var readyzRetryDuration = time.Second * 10
+
+var deletionCheckPeriod = time.Second * 5
 
 func ReconcileCluster(ctx *ModuleContext) (ctrl.Result, error) {
 	version := ctx.Spec.ClusterVersion
@@ -100,41 +198,103 @@ func ReconcileCluster(ctx *ModuleContext) (ctrl.Result, error) {
 		return ctrl.Result{}, fmt.Errorf("not support version %s", version)
 	}
 	ctx.Info("Begin Cluster Reconcile", "version", version, "name", ctx.Name, "namespace", ctx.Namespace)
+	if clusterv1.GetCondition(ctx.Status.Conditions, clusterv1.ConditionPaused) != nil {
+		clusterv1.SetCondition(&ctx.Status.Conditions, clusterv1.ConditionPaused, v13.ConditionFalse, "Resumed", "")
+	}
+	reconcileAt := ctx.GetAnnotations()[clusterv1.ReconcileAtAnnotation]
+	force := reconcileAt != "" && reconcileAt != ctx.Status.LastHandledReconcileAt
+	if force {
+		ctx.Info("force reconcile", "reconcileAt", reconcileAt)
+		ResetModuleRetries(ctx.Cluster)
+	}
 	total := len(modules)
+	var requeueAfter time.Duration
+	ready := true
 	for index, module := range modules {
 		moduleName := module.Name
 		moduleString := fmt.Sprintf("[%v/%v]%s ", index+1, total, moduleName)
 		ctx.Info(moduleString, "version", version, "name", ctx.Name, "namespace", ctx.Namespace)
+		if d, failed := ModuleBackoff(ctx.Cluster, moduleName); failed || d > 0 {
+			ctx.Info(moduleString+"module backoff", "failed", failed, "wait", d)
+			ready = false
+			if d > 0 && (requeueAfter == 0 || d < requeueAfter) {
+				requeueAfter = d
+			}
+			break
+		}
 		if err := module.Reconcile(ctx); err != nil {
 			ctx.Info(moduleString+"module not exist,create error", "error", err)
 			ctx.Recorder.Event(ctx, v13.EventTypeWarning, "ReconcileError", fmt.Sprintf("[%s] Error:%v", moduleName, err))
-			return ctrl.Result{
-				Requeue:      true,
-				RequeueAfter: retryDuration,
-			}, err
+			ready = false
+			clusterv1.SetCondition(&ctx.Status.Conditions, clusterv1.ConditionReady, v13.ConditionFalse, "ModuleError", moduleName)
+			if d := RecordModuleFailure(ctx.Cluster, moduleName, err); d == 0 {
+				ctx.Recorder.Event(ctx, v13.EventTypeWarning, "ReconcileFailed", fmt.Sprintf("[%s] reached max attempts", moduleName))
+			} else if requeueAfter == 0 || d < requeueAfter {
+				requeueAfter = d
+			}
+			break
+		}
+		ClearModuleRetry(ctx.Cluster, moduleName)
+		if d := module.Requeue(ctx.Cluster); d > 0 && (requeueAfter == 0 || d < requeueAfter) {
+			requeueAfter = d
 		}
 		if !module.Ready(ctx) {
+			ready = false
+			clusterv1.SetCondition(&ctx.Status.Conditions, clusterv1.ConditionReady, v13.ConditionFalse, "ModuleNotReady", moduleName)
 			break
 		}
 	}
-	ctx.Info("update Cluster(crd) status")
-	if len(ctx.GetFinalizers()) == 0 {
-		ctx.SetFinalizers([]string{FinalizerName})
+	if d, err := Remediate(ctx); err != nil {
+		ctx.Info("remediation error", "error", err)
+		ctx.Recorder.Event(ctx, v13.EventTypeWarning, "RemediationError", err.Error())
+	} else if d > 0 && (requeueAfter == 0 || d < requeueAfter) {
+		requeueAfter = d
 	}
-	if err := ctx.Update(ctx, ctx.Cluster); err != nil {
+	if err := syncClusterPlugins(ctx); err != nil {
+		ctx.Info("sync cluster plugins error", "error", err)
+		ctx.Recorder.Event(ctx, v13.EventTypeWarning, "PluginError", err.Error())
+		if requeueAfter == 0 || readyzRetryDuration < requeueAfter {
+			requeueAfter = readyzRetryDuration
+		}
+	}
+	if ready {
+		//status更新也会触发调谐,未到探测周期时不重复探测
+		period := readyzRetryDuration
+		if clusterv1.IsConditionTrue(ctx.Status.Conditions, clusterv1.ConditionReady) {
+			period = GuestProbePeriod
+		}
+		last := ctx.Status.Guest.LastProbeTime
+		if last == nil || force || time.Since(last.Time) >= period {
+			if err := ProbeGuest(ctx, ctx.Client, ctx.Cluster); err != nil {
+				clusterv1.SetCondition(&ctx.Status.Conditions, clusterv1.ConditionReady, v13.ConditionFalse, "ReadyzFailed", err.Error())
+				period = readyzRetryDuration
+			} else {
+				clusterv1.SetCondition(&ctx.Status.Conditions, clusterv1.ConditionReady, v13.ConditionTrue, "Ready", "")
+				period = GuestProbePeriod
+			}
+			last = ctx.Status.Guest.LastProbeTime
+		}
+		if d := period - time.Since(last.Time); requeueAfter == 0 || d < requeueAfter {
+			requeueAfter = d
+		}
+	}
+	if force {
+		ctx.Status.LastHandledReconcileAt = reconcileAt
+	}
+	ctx.Info("update Cluster(crd) status")
+	controllerutil.AddFinalizer(ctx.Cluster, FinalizerName)
+	if err := PatchStatusAndFinalizers(ctx, ctx.Client, ctx.Cluster, ctx.Original); err != nil {
 		ctx.Info("update Cluster(crd) status error", "error", err)
-		return ctrl.Result{
-			Requeue:      true,
-			RequeueAfter: retryDuration,
-		}, err
+		return ctrl.Result{}, err
 	}
 	ctx.Info("End Cluster Reconcile", "version", version)
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
 }
 
 func (r *ClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&clusterv1.Cluster{}).Owns(&v1.Deployment{}).Owns(&v12.Job{}).Owns(&v13.Service{}).Owns(&v1beta2.EtcdCluster{}).
+		Owns(&clusterv1.ClusterPlugin{}).
 		Complete(r)
 }
@@ -11,8 +11,10 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"time"
 )
 
 const FinalizerName = "finalizer.cluster.kok.tanx"
@@ -52,10 +54,12 @@ type ModuleContext struct {
 	*v1.Cluster
 	logr.Logger
 	*ClusterReconciler
+	//调谐开始时的Cluster拷贝,用于计算status及finalizers的patch
+	Original *v1.Cluster
 }
 
 func NewModuleContext(context context.Context, c *v1.Cluster, logger logr.Logger, r *ClusterReconciler) *ModuleContext {
-	return &ModuleContext{Context: context, Cluster: c, Logger: logger, ClusterReconciler: r}
+	return &ModuleContext{Context: context, Cluster: c, Logger: logger, ClusterReconciler: r, Original: c.DeepCopy()}
 }
 
 type InitConfig struct {
@@ -70,6 +74,7 @@ type InitConfig struct {
 	PodInfraContainerImage string
 }
 
+// Module BeforeCreate只在创建对象前调用,用于生成密钥等不应在每次Render时重复计算的内容
 type Module struct {
 	Name  string
 	Sub   []*Module
@@ -77,9 +82,16 @@ type Module struct {
 
 	GetObj               func() Object
 	Render               func(c *v1.Cluster) Object
+	BeforeCreate         func(c *v1.Cluster, obj Object) error
 	SetStatus            func(c *v1.Cluster, target, now Object) (bool, Object)
 	Del                  func(ctx context.Context, c *v1.Cluster, client client.Client) error
+	Gone                 func(ctx context.Context, c *v1.Cluster, client client.Client) (bool, error)
+	Retain               bool
 	Next                 func(c *v1.Cluster) bool
+	Skip                 func(c *v1.Cluster) bool
+	RequeueAfter         func(c *v1.Cluster) time.Duration
+	Probe                func(ctx context.Context, c *v1.Cluster, client client.Client)
+	Recreate             func(c *v1.Cluster, now Object) bool
 	SetDefault           func(c *v1.Cluster)
 	ValidateCreateModule func(c *v1.Cluster) field.ErrorList
 	ValidateUpdateModule func(now *v1.Cluster, old *v1.Cluster) field.ErrorList
@@ -131,6 +143,9 @@ func (m *Module) Default(c *v1.Cluster) {
 
 func (m *Module) Reconcile(ctx *ModuleContext) error {
 	if !m.hasSub() {
+		if m.skip(ctx.Cluster) {
+			return nil
+		}
 		exist, err := m.exist(ctx)
 		if err != nil {
 			return err
@@ -144,6 +159,9 @@ func (m *Module) Reconcile(ctx *ModuleContext) error {
 				return err
 			}
 		}
+		if m.Probe != nil {
+			m.Probe(ctx, ctx.Cluster, ctx.Client)
+		}
 	} else {
 		for _, m := range m.Sub {
 			if err := m.Reconcile(ctx); err != nil {
@@ -154,6 +172,63 @@ func (m *Module) Reconcile(ctx *ModuleContext) error {
 	return nil
 }
 
+// Observe 只读取已存在的对象刷新status,不创建或修改对象
+func (m *Module) Observe(ctx *ModuleContext) error {
+	if !m.hasSub() {
+		if m.skip(ctx.Cluster) {
+			return nil
+		}
+		obj := m.GetObj()
+		render := m.Render(ctx.Cluster)
+		err := ctx.Client.Get(ctx, client.ObjectKey{
+			Namespace: ctx.Namespace,
+			Name:      render.GetName(),
+		}, obj)
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		//SetStatus可能推进需要写入对象的状态机(如密钥轮换),在拷贝上执行,需要更新对象时丢弃status变化
+		c := ctx.Cluster.DeepCopy()
+		if needUpdate, _ := m.SetStatus(c, render, obj.DeepCopyObject().(Object)); !needUpdate {
+			ctx.Status = c.Status
+		}
+		if m.Probe != nil {
+			m.Probe(ctx, ctx.Cluster, ctx.Client)
+		}
+		return nil
+	}
+	for _, m := range m.Sub {
+		if err := m.Observe(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Requeue 返回模块需要再次调谐的最短等待时间,0表示不需要
+func (m *Module) Requeue(c *v1.Cluster) time.Duration {
+	if !m.hasSub() {
+		if m.skip(c) || m.RequeueAfter == nil {
+			return 0
+		}
+		return m.RequeueAfter(c)
+	}
+	var min time.Duration
+	for _, m := range m.Sub {
+		if d := m.Requeue(c); d > 0 && (min == 0 || d < min) {
+			min = d
+		}
+	}
+	return min
+}
+
+func (m *Module) skip(c *v1.Cluster) bool {
+	return m.Skip != nil && m.Skip(c)
+}
+
 func (m *Module) hasSub() bool {
 	if m.Sub == nil || len(m.Sub) == 0 {
 		return false
@@ -176,23 +251,39 @@ func (m *Module) exist(ctx *ModuleContext) (bool, error) {
 	return false, err
 }
 
+// update 读取当前对象并更新,遇到冲突时重新读取后重试.
+// SetStatus,Recreate会推进状态机及修复计数,在Cluster拷贝上执行,成功后才写回,避免每次重试重复计数
 func (m *Module) update(ctx *ModuleContext) error {
-	obj := m.GetObj()
-	render := m.Render(ctx.Cluster)
-	if err := ctx.Client.Get(ctx, client.ObjectKey{
-		Namespace: ctx.Namespace,
-		Name:      render.GetName(),
-	}, obj); err != nil {
-		return err
-	}
-
-	needUpdate, o := m.SetStatus(ctx.Cluster, render, obj)
-	if needUpdate {
-		if err := ctx.Client.Update(ctx.Context, o); err != nil {
+	var status v1.ClusterStatus
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		c := ctx.Cluster.DeepCopy()
+		obj := m.GetObj()
+		render := m.Render(c)
+		if err := ctx.Client.Get(ctx, client.ObjectKey{
+			Namespace: ctx.Namespace,
+			Name:      render.GetName(),
+		}, obj); err != nil {
 			return err
 		}
+
+		needUpdate, o := m.SetStatus(c, render, obj)
+		recreate := m.Recreate != nil && m.Recreate(c, o)
+		status = c.Status
+		if recreate {
+			ctx.Recorder.Event(ctx, v12.EventTypeWarning, "Recreating", o.GetName())
+			policy := metav1.DeletePropagationBackground
+			err := ctx.Client.Delete(ctx.Context, o, &client.DeleteOptions{PropagationPolicy: &policy})
+			return client.IgnoreNotFound(err)
+		}
+		if needUpdate {
+			return ctx.Client.Update(ctx.Context, o)
+		}
+		return nil
+	})
+	if err == nil {
+		ctx.Status = status
 	}
-	return nil
+	return err
 }
 
 func (m *Module) create(ctx *ModuleContext) error {
@@ -200,6 +291,11 @@ func (m *Module) create(ctx *ModuleContext) error {
 	if err := controllerutil.SetControllerReference(ctx.Cluster, render, ctx.Scheme); err != nil {
 		return err
 	}
+	if m.BeforeCreate != nil {
+		if err := m.BeforeCreate(ctx.Cluster, render); err != nil {
+			return err
+		}
+	}
 	ctx.Recorder.Event(ctx, v12.EventTypeNormal, "Creating", render.GetName())
 	err := ctx.Client.Create(ctx, render)
 	if err != nil && errors.IsAlreadyExists(err) {
@@ -213,6 +309,9 @@ func (m *Module) create(ctx *ModuleContext) error {
 
 func (m *Module) Ready(ctx *ModuleContext) bool {
 	if !m.hasSub() {
+		if m.skip(ctx.Cluster) {
+			return true
+		}
 		if m.Next != nil {
 			return m.Next(ctx.Cluster)
 		}
@@ -227,8 +326,19 @@ func (m *Module) Ready(ctx *ModuleContext) bool {
 	return true
 }
 
+// Delete 按与创建相反的顺序删除模块的对象(前台删除,依赖对象删除后才消失)及Del中的附属资源.
+// deletionPolicy为Retain时跳过Retain模块
 func (m *Module) Delete(ctx *ModuleContext) error {
 	if !m.hasSub() {
+		if m.skip(ctx.Cluster) || m.retained(ctx.Cluster) {
+			return nil
+		}
+		render := m.Render(ctx.Cluster)
+		policy := metav1.DeletePropagationForeground
+		err := ctx.Client.Delete(ctx, render, &client.DeleteOptions{PropagationPolicy: &policy})
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
 		if m.Del != nil {
 			err := m.Del(ctx, ctx.Cluster, ctx.Client)
 			if err != nil {
@@ -236,11 +346,39 @@ func (m *Module) Delete(ctx *ModuleContext) error {
 			}
 			return err
 		}
+		return nil
 	}
-	for _, m := range m.Sub {
-		if err := m.Delete(ctx); err != nil {
+	for i := len(m.Sub) - 1; i >= 0; i-- {
+		if err := m.Sub[i].Delete(ctx); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// Deleted 模块的对象及Del中的附属资源是否都已消失
+func (m *Module) Deleted(ctx *ModuleContext) (bool, error) {
+	if !m.hasSub() {
+		if m.skip(ctx.Cluster) || m.retained(ctx.Cluster) {
+			return true, nil
+		}
+		exist, err := m.exist(ctx)
+		if err != nil || exist {
+			return false, err
+		}
+		if m.Gone != nil {
+			return m.Gone(ctx, ctx.Cluster, ctx.Client)
+		}
+		return true, nil
+	}
+	for _, m := range m.Sub {
+		if deleted, err := m.Deleted(ctx); err != nil || !deleted {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (m *Module) retained(c *v1.Cluster) bool {
+	return m.Retain && c.Spec.DeletionPolicy == v1.DeletionPolicyRetain
+}
@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"fmt"
+	clusterv1 "github.com/kok-stack/kok/api/v1"
+	v13 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"reflect"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sort"
+)
+
+const pluginEntryLabel = "kok.tanx/plugin-entry"
+
+// syncClusterPlugins 将spec.plugins同步为Cluster拥有的ClusterPlugin,删除已移除的项(由插件控制器uninstall),并汇总状态
+func syncClusterPlugins(ctx *ModuleContext) error {
+	list := &clusterv1.ClusterPluginList{}
+	if err := ctx.List(ctx, list, client.InNamespace(ctx.Namespace), client.MatchingLabels{"cluster": ctx.Name}); err != nil {
+		return err
+	}
+	owned := map[string]*clusterv1.ClusterPlugin{}
+	for i := range list.Items {
+		if p := &list.Items[i]; metav1.IsControlledBy(p, ctx.Cluster) {
+			owned[p.Labels[pluginEntryLabel]] = p
+		}
+	}
+
+	summaries := make([]clusterv1.ClusterPluginSummary, 0, len(owned))
+	desired := map[string]bool{}
+	for _, entry := range ctx.Spec.Plugins {
+		desired[entry.Name] = true
+		p, err := applyClusterPlugin(ctx, entry, owned[entry.Name])
+		if err != nil {
+			return err
+		}
+		summaries = append(summaries, pluginSummary(entry.Name, p, false))
+	}
+	//按名称排序,避免status因map顺序变化
+	var removed []string
+	for name := range owned {
+		if !desired[name] {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		p := owned[name]
+		if p.DeletionTimestamp.IsZero() {
+			ctx.Recorder.Event(ctx, v13.EventTypeNormal, "DeletePlugin", p.Name)
+			if err := ctx.Delete(ctx, p); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		}
+		summaries = append(summaries, pluginSummary(name, p, true))
+	}
+	if len(summaries) == 0 {
+		summaries = nil
+	}
+	ctx.Status.Plugins = summaries
+	return nil
+}
+
+// applyClusterPlugin 创建或更新spec.plugins中一项对应的ClusterPlugin,dependsOn为该项与模板中依赖的合并
+func applyClusterPlugin(ctx *ModuleContext, entry clusterv1.ClusterPluginEntry, existing *clusterv1.ClusterPlugin) (*clusterv1.ClusterPlugin, error) {
+	template := entry.Template.DeepCopy()
+	var dependsOn []clusterv1.ClusterPluginReference
+	for _, dep := range entry.DependsOn {
+		dependsOn = append(dependsOn, clusterv1.ClusterPluginReference{
+			Kind: clusterPluginKind,
+			Name: pluginEntryName(ctx.Cluster, dep),
+		})
+	}
+	templateDeps, err := templateDependencies(ctx, entry.Template)
+	if err != nil {
+		return nil, err
+	}
+	dependsOn = mergeDependencies(dependsOn, templateDeps)
+
+	if existing == nil {
+		p := &clusterv1.ClusterPlugin{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      pluginEntryName(ctx.Cluster, entry.Name),
+				Namespace: ctx.Namespace,
+				Labels: map[string]string{
+					"cluster":        ctx.Name,
+					pluginEntryLabel: entry.Name,
+				},
+			},
+			Spec: clusterv1.ClusterPluginSpec{
+				CLusterPluginSpecInner: clusterv1.CLusterPluginSpecInner{DependsOn: dependsOn},
+				ClusterName:            ctx.Name,
+				Template:               template,
+			},
+		}
+		if err := controllerutil.SetControllerReference(ctx.Cluster, p, ctx.Scheme); err != nil {
+			return nil, err
+		}
+		ctx.Recorder.Event(ctx, v13.EventTypeNormal, "CreatePlugin", p.Name)
+		err := ctx.Create(ctx, p)
+		if errors.IsAlreadyExists(err) {
+			return nil, fmt.Errorf("ClusterPlugin %s already exists and is not owned by cluster", p.Name)
+		}
+		return p, err
+	}
+
+	if reflect.DeepEqual(existing.Spec.Template, template) && reflect.DeepEqual(existing.Spec.DependsOn, dependsOn) {
+		return existing, nil
+	}
+	orig := existing.DeepCopy()
+	existing.Spec.Template = template
+	existing.Spec.DependsOn = dependsOn
+	ctx.Info("update cluster plugin", "name", existing.Name)
+	return existing, ctx.Patch(ctx, existing, client.MergeFrom(orig))
+}
+
+func pluginSummary(name string, p *clusterv1.ClusterPlugin, removing bool) clusterv1.ClusterPluginSummary {
+	summary := clusterv1.ClusterPluginSummary{
+		Name:          name,
+		PluginName:    p.Name,
+		InstallStatus: p.Status.InstallStatus.Status,
+		Ready:         p.Generation > 0 && installSucceeded(p),
+		Removing:      removing,
+	}
+	for _, t := range []clusterv1.ConditionType{clusterv1.ConditionWaitingForCluster, clusterv1.ConditionWaitingForDependencies} {
+		if c := clusterv1.GetCondition(p.Status.Conditions, t); c != nil && c.Status == v13.ConditionTrue {
+			summary.Message = fmt.Sprintf("%s: %s", c.Reason, c.Message)
+			break
+		}
+	}
+	return summary
+}
+
+// templateDependencies 模板渲染后的dependsOn,模板不存在时由插件控制器报告错误
+func templateDependencies(ctx *ModuleContext, ref clusterv1.ClusterPluginTemplateRef) ([]clusterv1.ClusterPluginReference, error) {
+	tmpl := &clusterv1.ClusterPluginTemplate{}
+	err := ctx.Get(ctx, types.NamespacedName{Namespace: ctx.Namespace, Name: ref.Name}, tmpl)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := tmpl.Render(ref.Values)
+	if err != nil {
+		return tmpl.Spec.Template.DependsOn, nil
+	}
+	return rendered.DependsOn, nil
+}
+
+func pluginEntryName(c *clusterv1.Cluster, name string) string {
+	return fmt.Sprintf("%s-%s", c.Name, name)
+}
@@ -0,0 +1,319 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	v13 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	clusterv1 "github.com/kok-stack/kok/api/v1"
+)
+
+const (
+	credentialHashAnnotation = "kok.tanx/credential-hash"
+	credentialKubeconfigKey  = "kubeconfig"
+	defaultCredentialTTL     = time.Hour * 24
+	credentialClockSkew      = time.Minute * 5
+	systemIdentityPrefix     = "system:"
+	maxIssuedCredentials     = 10
+)
+
+// ClusterCredentialReconciler reconciles a ClusterCredential object
+type ClusterCredentialReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=cluster.kok.tanx,resources=clustercredentials,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=cluster.kok.tanx,resources=clustercredentials/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+
+func (r *ClusterCredentialReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("cluster_credential", req.NamespacedName)
+
+	cc := &clusterv1.ClusterCredential{}
+	if err := r.Client.Get(ctx, req.NamespacedName, cc); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !cc.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	now := time.Now()
+	hash := credentialHash(cc)
+	secretName := fmt.Sprintf("%s-%s-kubeconfig", cc.Spec.ClusterName, cc.Name)
+
+	//已过期的凭证不再续签,删除kubeconfig,除非spec发生变化
+	if cc.Status.ExpirationTime != nil && !now.Before(cc.Status.ExpirationTime.Time) {
+		secret := &v13.Secret{}
+		err := r.Client.Get(ctx, types.NamespacedName{Namespace: cc.Namespace, Name: secretName}, secret)
+		if err != nil && !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		if err == nil && secret.Annotations[credentialHashAnnotation] == hash {
+			if err := r.Client.Delete(ctx, secret); err != nil && !errors.IsNotFound(err) {
+				return ctrl.Result{}, err
+			}
+			r.Recorder.Event(cc, v13.EventTypeNormal, "Expired", fmt.Sprintf("kubeconfig %s revoked", secretName))
+		}
+		if err != nil || secret.Annotations[credentialHashAnnotation] == hash {
+			if cc.Status.Phase != clusterv1.CredentialExpired {
+				cc.Status.Phase = clusterv1.CredentialExpired
+				cc.Status.SecretName = ""
+				cc.Status.Message = ""
+				return ctrl.Result{}, r.Status().Update(ctx, cc)
+			}
+			if len(cc.Status.Issued) == 0 || credentialHashOf(cc.Status.Issued[len(cc.Status.Issued)-1]) == hash {
+				return ctrl.Result{}, nil
+			}
+		}
+	}
+
+	secret := &v13.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{Namespace: cc.Namespace, Name: secretName}, secret)
+	if err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	if err == nil && secret.Annotations[credentialHashAnnotation] == hash && cc.Status.ExpirationTime != nil {
+		return ctrl.Result{RequeueAfter: cc.Status.ExpirationTime.Sub(now)}, nil
+	}
+
+	//webhook未生效时同样不签发
+	if errs := validateCredential(cc); len(errs) > 0 {
+		cc.Status.Phase = clusterv1.CredentialPending
+		cc.Status.Message = errs.ToAggregate().Error()
+		return ctrl.Result{}, r.Status().Update(ctx, cc)
+	}
+
+	cluster := &clusterv1.Cluster{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: cc.Namespace, Name: cc.Spec.ClusterName}, cluster); err != nil {
+		return ctrl.Result{}, err
+	}
+	if cluster.Status.Init.CaPkiName == "" {
+		log.Info("cluster pki not ready")
+		cc.Status.Phase = clusterv1.CredentialPending
+		cc.Status.Message = "waiting for cluster pki"
+		if err := r.Status().Update(ctx, cc); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: time.Second * 10}, nil
+	}
+	ca := &v13.Secret{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: cc.Namespace, Name: cluster.Status.Init.CaPkiName}, ca); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	issued, kubeconfig, err := issueCredential(cc, cluster, ca, now)
+	if err != nil {
+		log.Info("issue credential error", "error", err)
+		r.Recorder.Event(cc, v13.EventTypeWarning, "IssueError", err.Error())
+		cc.Status.Phase = clusterv1.CredentialPending
+		cc.Status.Message = err.Error()
+		if err := r.Status().Update(ctx, cc); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, err
+	}
+	issued.SecretName = secretName
+
+	secret.Name = secretName
+	secret.Namespace = cc.Namespace
+	secret.Annotations = map[string]string{credentialHashAnnotation: hash}
+	secret.Data = map[string][]byte{credentialKubeconfigKey: kubeconfig}
+	if err := controllerutil.SetControllerReference(cc, secret, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+	if secret.ResourceVersion == "" {
+		err = r.Client.Create(ctx, secret)
+	} else {
+		err = r.Client.Update(ctx, secret)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	r.Recorder.Event(cc, v13.EventTypeNormal, "Issued", fmt.Sprintf("kubeconfig %s issued, serial %s", secretName, issued.SerialNumber))
+
+	cc.Status.Phase = clusterv1.CredentialIssued
+	cc.Status.SecretName = secretName
+	cc.Status.ExpirationTime = &issued.NotAfter
+	cc.Status.Message = ""
+	cc.Status.Issued = append(cc.Status.Issued, issued)
+	if len(cc.Status.Issued) > maxIssuedCredentials {
+		cc.Status.Issued = cc.Status.Issued[len(cc.Status.Issued)-maxIssuedCredentials:]
+	}
+	if err := r.Status().Update(ctx, cc); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: issued.NotAfter.Sub(now)}, nil
+}
+
+func issueCredential(cc *clusterv1.ClusterCredential, cluster *clusterv1.Cluster, ca *v13.Secret, now time.Time) (clusterv1.IssuedCredential, []byte, error) {
+	caCert, caKey, err := parseCA(ca.Data["ca.pem"], ca.Data["ca-key.pem"])
+	if err != nil {
+		return clusterv1.IssuedCredential{}, nil, err
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return clusterv1.IssuedCredential{}, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return clusterv1.IssuedCredential{}, nil, err
+	}
+	ttl := credentialTTL(cc)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   cc.Spec.Username,
+			Organization: cc.Spec.Groups,
+		},
+		NotBefore:   now.Add(-credentialClockSkew),
+		NotAfter:    now.Add(ttl),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return clusterv1.IssuedCredential{}, nil, err
+	}
+
+	config := clientcmdapi.NewConfig()
+	config.Clusters["kubernetes"] = &clientcmdapi.Cluster{
+		Server:                   fmt.Sprintf("https://%s:%s", cluster.Spec.AccessSpec.Address, cluster.Spec.AccessSpec.Port),
+		CertificateAuthorityData: ca.Data["ca.pem"],
+	}
+	config.AuthInfos[cc.Spec.Username] = &clientcmdapi.AuthInfo{
+		ClientCertificateData: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		ClientKeyData:         pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+	}
+	config.Contexts["kubernetes"] = &clientcmdapi.Context{
+		Cluster:   "kubernetes",
+		AuthInfo:  cc.Spec.Username,
+		Namespace: "default",
+	}
+	config.CurrentContext = "kubernetes"
+	kubeconfig, err := clientcmd.Write(*config)
+	if err != nil {
+		return clusterv1.IssuedCredential{}, nil, err
+	}
+
+	return clusterv1.IssuedCredential{
+		SerialNumber: serial.Text(16),
+		Username:     cc.Spec.Username,
+		Groups:       cc.Spec.Groups,
+		NotBefore:    metav1.NewTime(template.NotBefore),
+		NotAfter:     metav1.NewTime(template.NotAfter),
+	}, kubeconfig, nil
+}
+
+func parseCA(certPEM, keyPEM []byte) (*x509.Certificate, interface{}, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, nil, fmt.Errorf("ca certificate not found")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, nil, fmt.Errorf("ca key not found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes); err == nil {
+		return cert, key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// validateCredential 用户名不能为空,system:开头的身份需要显式开启,
+// 不能使用apiserver客户端证书的CN,否则可以调用token review webhook
+func validateCredential(cc *clusterv1.ClusterCredential) field.ErrorList {
+	var allErrs field.ErrorList
+	path := field.NewPath("spec")
+	switch {
+	case cc.Spec.Username == "":
+		allErrs = append(allErrs, field.Required(path.Child("username"), "不能为空"))
+	case cc.Spec.Username == TokenReviewClientCommonName:
+		allErrs = append(allErrs, field.Forbidden(path.Child("username"), "该用户名保留给集群apiserver"))
+	case strings.HasPrefix(cc.Spec.Username, systemIdentityPrefix) && !cc.Spec.AllowSystemIdentity:
+		allErrs = append(allErrs, field.Forbidden(path.Child("username"), "system:开头的用户名需要设置allowSystemIdentity"))
+	}
+	for i, group := range cc.Spec.Groups {
+		if group == "" {
+			allErrs = append(allErrs, field.Required(path.Child("groups").Index(i), "不能为空"))
+		} else if strings.HasPrefix(group, systemIdentityPrefix) && !cc.Spec.AllowSystemIdentity {
+			allErrs = append(allErrs, field.Forbidden(path.Child("groups").Index(i), "system:开头的组需要设置allowSystemIdentity"))
+		}
+	}
+	return allErrs
+}
+
+func credentialTTL(cc *clusterv1.ClusterCredential) time.Duration {
+	if cc.Spec.TTL.Duration <= 0 {
+		return defaultCredentialTTL
+	}
+	return cc.Spec.TTL.Duration
+}
+
+func credentialHash(cc *clusterv1.ClusterCredential) string {
+	return hashCredential(cc.Spec.Username, cc.Spec.Groups, credentialTTL(cc))
+}
+
+func credentialHashOf(issued clusterv1.IssuedCredential) string {
+	//签发记录中没有ttl,根据证书有效期还原
+	return hashCredential(issued.Username, issued.Groups, issued.NotAfter.Sub(issued.NotBefore.Time)-credentialClockSkew)
+}
+
+func hashCredential(username string, groups []string, ttl time.Duration) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(username+"/"+strings.Join(groups, ",")+"/"+ttl.Truncate(time.Second).String())))[:16]
+}
+
+func (r *ClusterCredentialReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&clusterv1.ClusterCredential{}).Owns(&v13.Secret{}).
+		Complete(r)
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	clusterv1 "github.com/kok-stack/kok/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCredentialHash(t *testing.T) {
+	cc := &clusterv1.ClusterCredential{}
+	cc.Spec.Username = "u"
+	cc.Spec.Groups = []string{"g"}
+	hash := credentialHash(cc)
+
+	//与issueCredential一致的有效期,并模拟status序列化后的精度
+	now := time.Now()
+	issued := clusterv1.IssuedCredential{
+		Username:  "u",
+		Groups:    []string{"g"},
+		NotBefore: metav1.NewTime(now.Add(-credentialClockSkew)).Rfc3339Copy(),
+		NotAfter:  metav1.NewTime(now.Add(defaultCredentialTTL)).Rfc3339Copy(),
+	}
+	if got := credentialHashOf(issued); got != hash {
+		t.Errorf("credentialHashOf() = %s, want %s", got, hash)
+	}
+
+	cc.Spec.TTL = metav1.Duration{Duration: time.Hour}
+	if credentialHash(cc) == hash {
+		t.Error("hash unchanged after ttl change")
+	}
+	cc.Spec.TTL = metav1.Duration{Duration: defaultCredentialTTL}
+	if credentialHash(cc) != hash {
+		t.Error("explicit default ttl changed hash")
+	}
+}
+
+func TestValidateCredential(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		groups   []string
+		allow    bool
+		errs     int
+	}{
+		{name: "valid", username: "alice", groups: []string{"dev"}},
+		{name: "empty username", username: "", errs: 1},
+		{name: "apiserver username", username: TokenReviewClientCommonName, allow: true, errs: 1},
+		{name: "system username", username: "system:apiserver", errs: 1},
+		{name: "system group", username: "alice", groups: []string{"dev", "system:masters"}, errs: 1},
+		{name: "empty group", username: "alice", groups: []string{""}, errs: 1},
+		{name: "system identity allowed", username: "system:apiserver", groups: []string{"system:masters"}, allow: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := &clusterv1.ClusterCredential{}
+			cc.Spec.Username = tt.username
+			cc.Spec.Groups = tt.groups
+			cc.Spec.AllowSystemIdentity = tt.allow
+			if errs := validateCredential(cc); len(errs) != tt.errs {
+				t.Errorf("validateCredential() = %v, want %d errors", errs, tt.errs)
+			}
+		})
+	}
+}
@@ -18,12 +18,16 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	batchv1 "k8s.io/api/batch/v1"
 	v13 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
+	"path"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"strings"
 
@@ -31,6 +35,8 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	clusterv1 "github.com/kok-stack/kok/api/v1"
 )
@@ -56,49 +62,84 @@ type PluginModuleContext struct {
 	*clusterv1.Cluster
 	Clusters   []*clusterv1.Cluster
 	AddVolumes func(*PluginModuleContext, *v13.PodSpec) *v13.PodSpec
+	//调谐开始时对象的拷贝,用于patch status
+	Original clusterv1.ClusterPluginObj
 }
 
 type ClusterPluginModule struct {
 	Name                string
-	create              func(ctx *PluginModuleContext) (*v13.Pod, error)
-	next                func(ctx *PluginModuleContext, p *v13.Pod) bool
-	updateClusterPlugin func(ctx *PluginModuleContext, p *v13.Pod)
+	create              func(ctx *PluginModuleContext) (*batchv1.Job, error)
+	next                func(ctx *PluginModuleContext, j *batchv1.Job) bool
+	updateClusterPlugin func(ctx *PluginModuleContext, j *batchv1.Job)
 }
 
 var modules = []*ClusterPluginModule{install, unInstall, del}
 
+const pluginSpecHashAnnotation = "kok.tanx/plugin-spec-hash"
+
+var (
+	defaultPluginBackoffLimit          int32 = 3
+	defaultPluginActiveDeadlineSeconds int64 = 600
+	pluginHistoryLimit                       = 10
+)
+
 var del = &ClusterPluginModule{
 	Name: "delete",
-	create: func(ctx *PluginModuleContext) (*v13.Pod, error) {
-		podNames := []string{ctx.ClusterPluginObj.GetStatus().InstallStatus.PodName, ctx.ClusterPluginObj.GetStatus().UninstallStatus.PodName}
-		for _, name := range podNames {
-			if err := ctx.Client.Delete(ctx.Context, &v13.Pod{
+	create: func(ctx *PluginModuleContext) (*batchv1.Job, error) {
+		status := ctx.ClusterPluginObj.GetStatus()
+		jobNames := []string{status.InstallStatus.JobName, status.UninstallStatus.JobName}
+		for _, run := range status.History {
+			jobNames = append(jobNames, run.JobName)
+		}
+		for _, member := range status.Clusters {
+			jobNames = append(jobNames, member.InstallStatus.JobName, member.UninstallStatus.JobName)
+		}
+		policy := metav1.DeletePropagationBackground
+		for _, name := range jobNames {
+			if name == "" {
+				continue
+			}
+			if err := ctx.Client.Delete(ctx.Context, &batchv1.Job{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      name,
 					Namespace: ctx.ClusterPluginObj.GetNamespace(),
 				},
-			}); err != nil {
+			}, &client.DeleteOptions{PropagationPolicy: &policy}); client.IgnoreNotFound(err) != nil {
 				return nil, err
 			}
 		}
 		return nil, nil
 	},
-	next: func(ctx *PluginModuleContext, p *v13.Pod) bool {
+	next: func(ctx *PluginModuleContext, j *batchv1.Job) bool {
 		return false
 	},
-	updateClusterPlugin: func(ctx *PluginModuleContext, p *v13.Pod) {
-		if len(ctx.ClusterPluginObj.GetFinalizers()) != 0 {
-			ctx.ClusterPluginObj.SetFinalizers([]string{})
-		}
+	updateClusterPlugin: func(ctx *PluginModuleContext, j *batchv1.Job) {
+		controllerutil.RemoveFinalizer(ctx.ClusterPluginObj, ClusterPluginFinalizerName)
 	},
 }
 
 var install = &ClusterPluginModule{
 	Name: "install",
-	create: getCreateFunc(func(ctx *PluginModuleContext) clusterv1.ClusterPluginPodSpec {
-		return ctx.ClusterPluginObj.GetSpec().Install
-	}, "install"),
-	next: func(ctx *PluginModuleContext, p *v13.Pod) bool {
+	create: func(ctx *PluginModuleContext) (*batchv1.Job, error) {
+		spec := ctx.ClusterPluginObj.GetSpec().Install
+		hash := installHash(ctx.ClusterPluginObj)
+		last := ctx.ClusterPluginObj.GetStatus().InstallStatus
+		name := getJobName(ctx.ClusterPluginObj, "install-"+hash[:8])
+		//上一次install未结束(或正在删除)时不按新的spec运行
+		deleting := !ctx.ClusterPluginObj.GetDeletionTimestamp().IsZero()
+		//从未install(等待集群或依赖时被删除)时不再创建install job
+		if deleting && last.JobName == "" {
+			return nil, nil
+		}
+		if last.JobName != "" && last.JobName != name && (deleting || !jobFinished(last.Status)) {
+			j, err := getJob(ctx, last.JobName)
+			if err != nil || j != nil || deleting {
+				return j, err
+			}
+		}
+		return getOrCreateJob(ctx, name, spec, hash, last)
+	},
+	next: func(ctx *PluginModuleContext, j *batchv1.Job) bool {
 		if !ctx.ClusterPluginObj.GetDeletionTimestamp().IsZero() &&
 			ctx.ClusterPluginObj.GetStatus().InstallStatus.Status != v13.PodPending &&
 			ctx.ClusterPluginObj.GetStatus().InstallStatus.Status != v13.PodRunning {
@@ -106,20 +147,68 @@ var install = &ClusterPluginModule{
 		}
 		return false
 	},
-	updateClusterPlugin: func(ctx *PluginModuleContext, p *v13.Pod) {
+	updateClusterPlugin: func(ctx *PluginModuleContext, j *batchv1.Job) {
 		status := ctx.ClusterPluginObj.GetStatus()
-		status.InstallStatus.PodName = p.Name
-		status.InstallStatus.Status = p.Status.Phase
+		//spec变化后开始新的运行,之前的运行记录到history
+		if j != nil && status.InstallStatus.JobName != "" && status.InstallStatus.JobName != j.Name {
+			status.History = append(status.History, status.InstallStatus)
+			if len(status.History) > pluginHistoryLimit {
+				status.History = status.History[len(status.History)-pluginHistoryLimit:]
+			}
+			status.InstallStatus = clusterv1.ClusterPluginPodStatus{}
+		}
+		setJobStatus(&status.InstallStatus, j)
+		if status.InstallStatus.Status == v13.PodSucceeded && status.InstallStatus.SpecHash == installHash(ctx.ClusterPluginObj) {
+			status.ObservedGeneration = ctx.ClusterPluginObj.GetGeneration()
+		}
 		ctx.ClusterPluginObj.UpdateStatus(status)
-		if len(ctx.ClusterPluginObj.GetFinalizers()) == 0 {
-			ctx.ClusterPluginObj.SetFinalizers([]string{ClusterPluginFinalizerName})
+		if ctx.ClusterPluginObj.GetDeletionTimestamp().IsZero() {
+			controllerutil.AddFinalizer(ctx.ClusterPluginObj, ClusterPluginFinalizerName)
 		}
 	},
 }
 
 const MountPath = "/etc/cluster/"
 
+// kubeconfigVolumeName 注入的kubeconfig卷,使用kok前缀避免与podTemplate中的卷重名
+const kubeconfigVolumeName = "kok-kubeconfig"
+
+// addKubeconfigMounts 为所有容器挂载kubeconfig卷,容器已占用的路径不再挂载,避免job因路径重复被拒绝
+func addKubeconfigMounts(spec *v13.PodSpec, paths ...string) {
+	add := func(containers []v13.Container) {
+		for i := range containers {
+			used := map[string]bool{}
+			for _, m := range containers[i].VolumeMounts {
+				used[path.Clean(m.MountPath)] = true
+			}
+			for _, p := range paths {
+				if used[path.Clean(p)] {
+					continue
+				}
+				containers[i].VolumeMounts = append(containers[i].VolumeMounts, v13.VolumeMount{
+					Name:      kubeconfigVolumeName,
+					ReadOnly:  true,
+					MountPath: p,
+				})
+			}
+		}
+	}
+	add(spec.InitContainers)
+	add(spec.Containers)
+}
+
+const maxJobNameLength = 63
+
+// convertSpec 转换为job的pod spec,设置podTemplate时直接使用其spec
 func convertSpec(spec clusterv1.ClusterPluginPodSpec) *v13.PodSpec {
+	if spec.PodTemplate != nil {
+		podSpec := spec.PodTemplate.Spec.DeepCopy()
+		//job只允许Never,OnFailure
+		if podSpec.RestartPolicy != v13.RestartPolicyOnFailure {
+			podSpec.RestartPolicy = v13.RestartPolicyNever
+		}
+		return podSpec
+	}
 	initContainers := make([]v13.Container, len(spec.InitContainers))
 	for i, container := range spec.InitContainers {
 		initContainers[i] = v13.Container{
@@ -212,71 +301,217 @@ func convertSpec(spec clusterv1.ClusterPluginPodSpec) *v13.PodSpec {
 	}
 }
 
-func getCreateFunc(f func(ctx *PluginModuleContext) clusterv1.ClusterPluginPodSpec, moduleName string) func(ctx *PluginModuleContext) (*v13.Pod, error) {
-	return func(ctx *PluginModuleContext) (*v13.Pod, error) {
-		name := getPodName(ctx.ClusterPluginObj, moduleName)
-		p := &v13.Pod{}
-		namespace := ctx.ClusterPluginObj.GetNamespace()
-		err := ctx.Get(ctx, types.NamespacedName{
-			Namespace: namespace,
+// getCreateFunc 返回创建uninstall job的函数
+func getCreateFunc(f func(ctx *PluginModuleContext) clusterv1.ClusterPluginPodSpec, last func(status clusterv1.ClusterPluginStatus) clusterv1.ClusterPluginPodStatus, moduleName string) func(ctx *PluginModuleContext) (*batchv1.Job, error) {
+	return func(ctx *PluginModuleContext) (*batchv1.Job, error) {
+		spec := f(ctx)
+		name := getJobName(ctx.ClusterPluginObj, moduleName)
+		return getOrCreateJob(ctx, name, spec, hashPluginSpec(spec), last(ctx.ClusterPluginObj.GetStatus()))
+	}
+}
+
+// getOrCreateJob 获取或创建job,job已结束且被ttl清理后不再重新创建
+func getOrCreateJob(ctx *PluginModuleContext, name string, spec clusterv1.ClusterPluginPodSpec, hash string, last clusterv1.ClusterPluginPodStatus) (*batchv1.Job, error) {
+	j, err := getJob(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	//重试时删除的job,等待删除后重新创建
+	if j != nil && !j.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+	if j != nil {
+		return j, nil
+	}
+	//相同spec已运行结束(包括名称规则变化前的job)时不重新运行
+	if (last.JobName == name || last.SpecHash == hash) && jobFinished(last.Status) {
+		return nil, nil
+	}
+	job := renderJob(ctx, name, spec)
+	job.Annotations = map[string]string{pluginSpecHashAnnotation: hash}
+	if err := controllerutil.SetControllerReference(ctx.ClusterPluginObj, job, ctx.Scheme); err != nil {
+		ctx.Info("set job owner error", "error", err)
+	}
+	if err := ctx.Client.Create(ctx.Context, job); err != nil {
+		ctx.Info("create job error", "error", err)
+		return nil, err
+	}
+	ctx.Event(ctx.ClusterPluginObj, v13.EventTypeNormal, "CreateJob", fmt.Sprintf("Job %s created", name))
+	return job, nil
+}
+
+func getJob(ctx *PluginModuleContext, name string) (*batchv1.Job, error) {
+	j := &batchv1.Job{}
+	err := ctx.Get(ctx, types.NamespacedName{
+		Namespace: ctx.ClusterPluginObj.GetNamespace(),
+		Name:      name,
+	}, j)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func hashPluginSpec(spec clusterv1.ClusterPluginPodSpec) string {
+	data, _ := json.Marshal(spec)
+	return fmt.Sprintf("%x", sha256.Sum256(data))[:16]
+}
+
+// installHash install运行的hash,MultiClusterPlugin包含目标集群,集群变化后重新install
+func installHash(obj clusterv1.ClusterPluginObj) string {
+	spec := obj.GetSpec().Install
+	if _, ok := obj.(*clusterv1.MultiClusterPlugin); !ok {
+		return hashPluginSpec(spec)
+	}
+	data, _ := json.Marshal(struct {
+		Spec     clusterv1.ClusterPluginPodSpec
+		Clusters string
+	}{spec, obj.GetClusterNames()})
+	return fmt.Sprintf("%x", sha256.Sum256(data))[:16]
+}
+
+func renderJob(ctx *PluginModuleContext, name string, podSpec clusterv1.ClusterPluginPodSpec) *batchv1.Job {
+	spec := convertSpec(podSpec)
+	spec = ctx.AddVolumes(ctx, spec)
+	inner := ctx.ClusterPluginObj.GetSpec()
+	backoffLimit := defaultPluginBackoffLimit
+	if inner.BackoffLimit != nil {
+		backoffLimit = *inner.BackoffLimit
+	}
+	activeDeadlineSeconds := defaultPluginActiveDeadlineSeconds
+	if inner.ActiveDeadlineSeconds != nil {
+		activeDeadlineSeconds = *inner.ActiveDeadlineSeconds
+	}
+	labels := map[string]string{
+		"cluster": jobClusterLabel(ctx),
+	}
+	//podTemplate的label,annotation保留在pod上,cluster label以kok为准
+	podMeta := metav1.ObjectMeta{Labels: map[string]string{}}
+	if podSpec.PodTemplate != nil {
+		podMeta.Annotations = podSpec.PodTemplate.Annotations
+		for k, v := range podSpec.PodTemplate.Labels {
+			podMeta.Labels[k] = v
+		}
+	}
+	for k, v := range labels {
+		podMeta.Labels[k] = v
+	}
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
-		}, p)
-		if err != nil && errors.IsNotFound(err) {
-			spec := convertSpec(f(ctx))
-			spec = ctx.AddVolumes(ctx, spec)
-			pod := &v13.Pod{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      name,
-					Namespace: namespace,
-					Labels: map[string]string{
-						"cluster": ctx.ClusterPluginObj.GetClusterNames(),
-					},
-				},
-				Spec: *spec,
-			}
-			if err := controllerutil.SetControllerReference(ctx.ClusterPluginObj, pod, ctx.Scheme); err != nil {
-				ctx.Info("set pod owner error", "error", err)
-			}
-			if err := ctx.Client.Create(ctx.Context, pod); err != nil {
-				ctx.Info("create pod error", "error", err)
-				return nil, err
-			}
-			ctx.Event(ctx.ClusterPluginObj, v13.EventTypeNormal, "CreatePod", fmt.Sprintf("Pod %s created", name))
-			return pod, nil
+			Namespace: ctx.ClusterPluginObj.GetNamespace(),
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			ActiveDeadlineSeconds:   &activeDeadlineSeconds,
+			TTLSecondsAfterFinished: inner.TTLSecondsAfterFinished,
+			Template: v13.PodTemplateSpec{
+				ObjectMeta: podMeta,
+				Spec:       *spec,
+			},
+		},
+	}
+}
+
+// jobClusterLabel job的cluster label.PerCluster的job只对应一个集群,
+// Single模式的job对应多个集群,逗号拼接的集群名不是合法的label值,使用插件名
+func jobClusterLabel(ctx *PluginModuleContext) string {
+	if _, ok := ctx.ClusterPluginObj.(*clusterv1.MultiClusterPlugin); !ok {
+		return ctx.ClusterPluginObj.GetClusterNames()
+	}
+	if perCluster(ctx.ClusterPluginObj) && len(ctx.Clusters) == 1 {
+		return ctx.Clusters[0].Name
+	}
+	return ctx.ClusterPluginObj.GetName()
+}
+
+// setJobStatus 将job状态转换为ClusterPluginPodStatus,job为空(已被ttl清理)时保留原状态
+func setJobStatus(status *clusterv1.ClusterPluginPodStatus, j *batchv1.Job) {
+	if j == nil {
+		return
+	}
+	status.JobName = j.Name
+	status.SpecHash = j.Annotations[pluginSpecHashAnnotation]
+	status.Status = jobPhase(j)
+	status.Attempts = j.Status.Active + j.Status.Succeeded + j.Status.Failed
+	if j.Status.Failed > status.Failed {
+		now := metav1.Now()
+		status.LastFailureReason = "PodFailed"
+		status.LastFailureMessage = fmt.Sprintf("%d of %d attempts failed", j.Status.Failed, status.Attempts)
+		status.LastFailureTime = &now
+	}
+	status.Failed = j.Status.Failed
+	for _, condition := range j.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == v13.ConditionTrue {
+			status.LastFailureReason = condition.Reason
+			status.LastFailureMessage = condition.Message
+			status.LastFailureTime = condition.LastTransitionTime.DeepCopy()
 		}
-		return p, err
 	}
+	status.StartTime = j.Status.StartTime
+	status.CompletionTime = j.Status.CompletionTime
+}
+
+func jobPhase(j *batchv1.Job) v13.PodPhase {
+	switch {
+	case jobCondition(j.Status, batchv1.JobComplete):
+		return v13.PodSucceeded
+	case jobCondition(j.Status, batchv1.JobFailed):
+		return v13.PodFailed
+	case j.Status.Active > 0:
+		return v13.PodRunning
+	}
+	return v13.PodPending
+}
+
+func jobFinished(phase v13.PodPhase) bool {
+	return phase == v13.PodSucceeded || phase == v13.PodFailed
 }
 
 //TODO:覆盖卸载失败的场景
 
+var createUninstall = getCreateFunc(func(ctx *PluginModuleContext) clusterv1.ClusterPluginPodSpec {
+	return ctx.ClusterPluginObj.GetSpec().Uninstall
+}, func(status clusterv1.ClusterPluginStatus) clusterv1.ClusterPluginPodStatus {
+	return status.UninstallStatus
+}, "uninstall")
+
 var unInstall = &ClusterPluginModule{
 	Name: "unInstall",
-	create: getCreateFunc(func(ctx *PluginModuleContext) clusterv1.ClusterPluginPodSpec {
-		return ctx.ClusterPluginObj.GetSpec().Uninstall
-	}, "uninstall"),
-	next: func(ctx *PluginModuleContext, p *v13.Pod) bool {
+	create: func(ctx *PluginModuleContext) (*batchv1.Job, error) {
+		if !uninstallNeeded(ctx.ClusterPluginObj) {
+			return nil, nil
+		}
+		return createUninstall(ctx)
+	},
+	next: func(ctx *PluginModuleContext, j *batchv1.Job) bool {
 		if !ctx.ClusterPluginObj.GetDeletionTimestamp().IsZero() &&
-			ctx.ClusterPluginObj.GetStatus().InstallStatus.Status != v13.PodPending &&
-			ctx.ClusterPluginObj.GetStatus().InstallStatus.Status != v13.PodRunning {
+			(!uninstallNeeded(ctx.ClusterPluginObj) || jobFinished(ctx.ClusterPluginObj.GetStatus().UninstallStatus.Status)) {
 			return true
 		}
 		return false
 	},
-	updateClusterPlugin: func(ctx *PluginModuleContext, p *v13.Pod) {
+	updateClusterPlugin: func(ctx *PluginModuleContext, j *batchv1.Job) {
 		status := ctx.ClusterPluginObj.GetStatus()
-		status.UninstallStatus.PodName = p.Name
-		status.UninstallStatus.Status = p.Status.Phase
+		setJobStatus(&status.UninstallStatus, j)
 		ctx.ClusterPluginObj.UpdateStatus(status)
 	},
 }
 
+// uninstallNeeded 正在删除且install运行过时才需要uninstall
+func uninstallNeeded(obj clusterv1.ClusterPluginObj) bool {
+	return !obj.GetDeletionTimestamp().IsZero() && obj.GetStatus().InstallStatus.JobName != "" && !obj.GetSpec().Uninstall.IsEmpty()
+}
+
 // +kubebuilder:rbac:groups=cluster.kok.tanx,resources=clusterplugins,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=cluster.kok.tanx,resources=clusterplugins/status,verbs=get;update;patch
 
 func (r *ClusterPluginReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
-	namespace := req.Namespace
 	log := r.Log.WithValues("cluster_plugin", req.NamespacedName)
 
 	cp := &clusterv1.ClusterPlugin{}
@@ -284,11 +519,20 @@ func (r *ClusterPluginReconciler) Reconcile(req ctrl.Request) (ctrl.Result, erro
 	if err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
-	cluster := &clusterv1.Cluster{}
-	if err := r.Client.Get(ctx, types.NamespacedName{
-		Namespace: namespace,
-		Name:      cp.Spec.ClusterName,
-	}, cluster); err != nil {
+	if cp.Spec.Template != nil && cp.DeletionTimestamp.IsZero() {
+		updated, err := renderPluginTemplate(ctx, r.Client, cp)
+		if err != nil {
+			log.Info("render template error", "error", err)
+			r.Recorder.Event(cp, v13.EventTypeWarning, "TemplateError", err.Error())
+			return ctrl.Result{}, err
+		}
+		if updated {
+			r.Recorder.Event(cp, v13.EventTypeNormal, "TemplateRendered", cp.Spec.Template.Name)
+			return ctrl.Result{}, nil
+		}
+	}
+	cluster, err := getPluginCluster(ctx, r.Client, cp, cp.Spec.ClusterName)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
 
@@ -302,42 +546,16 @@ func (r *ClusterPluginReconciler) Reconcile(req ctrl.Request) (ctrl.Result, erro
 		Cluster:          cluster,
 		Clusters:         nil,
 		AddVolumes:       clusterPluginAddVolume,
+		Original:         cp.DeepCopy(),
 	}
 	return reconcile(pmCtx)
 }
 
 func clusterPluginAddVolume(ctx *PluginModuleContext, spec *v13.PodSpec) *v13.PodSpec {
-	mount := []v13.VolumeMount{
-		{
-			Name:      "kubeconfig",
-			ReadOnly:  true,
-			MountPath: MountPath,
-		},
-		{
-			Name:      "kubeconfig",
-			ReadOnly:  true,
-			MountPath: "/root/.kube/",
-		},
-	}
-	for i, container := range spec.InitContainers {
-		if len(container.VolumeMounts) > 0 {
-			container.VolumeMounts = append(container.VolumeMounts, mount...)
-		} else {
-			container.VolumeMounts = mount
-		}
-		spec.Containers[i] = container
-	}
-	for i, container := range spec.Containers {
-		if len(container.VolumeMounts) > 0 {
-			container.VolumeMounts = append(container.VolumeMounts, mount...)
-		} else {
-			container.VolumeMounts = mount
-		}
-		spec.Containers[i] = container
-	}
+	addKubeconfigMounts(spec, MountPath, "/root/.kube/")
 
 	volume := v13.Volume{
-		Name: "kubeconfig",
+		Name: kubeconfigVolumeName,
 		VolumeSource: v13.VolumeSource{
 			Secret: &v13.SecretVolumeSource{
 				SecretName: ctx.Cluster.Status.Init.AdminConfigName,
@@ -362,21 +580,77 @@ func clusterPluginAddVolume(ctx *PluginModuleContext, spec *v13.PodSpec) *v13.Po
 func reconcile(pmCtx *PluginModuleContext) (ctrl.Result, error) {
 	//install,uninstall,delete
 	//create,next,updateCP
-	total := len(modules)
-	for i, module := range modules {
+	orig := pmCtx.Original
+	//删除时不再等待集群就绪,在依赖于本插件的插件uninstall完成后执行uninstall
+	if pmCtx.ClusterPluginObj.GetDeletionTimestamp().IsZero() {
+		status := pmCtx.ClusterPluginObj.GetStatus()
+		waiting := waitingClusters(pmCtx)
+		//PerCluster模式下未就绪的集群不阻塞其他集群install
+		partial := perCluster(pmCtx.ClusterPluginObj) && len(waiting) < len(pmCtx.Clusters)
+		if len(waiting) > 0 {
+			pmCtx.Info("waiting for cluster", "clusters", waiting)
+			clusterv1.SetCondition(&status.Conditions, clusterv1.ConditionWaitingForCluster, v13.ConditionTrue, "ClusterNotReady", strings.Join(waiting, ","))
+			pmCtx.ClusterPluginObj.UpdateStatus(status)
+			if !partial {
+				return ctrl.Result{}, PatchStatusAndFinalizers(pmCtx.Context, pmCtx.Client, pmCtx.ClusterPluginObj, orig)
+			}
+		} else {
+			clusterv1.SetCondition(&status.Conditions, clusterv1.ConditionWaitingForCluster, v13.ConditionFalse, "ClusterReady", "")
+			pmCtx.ClusterPluginObj.UpdateStatus(status)
+		}
+		if installPending(pmCtx.ClusterPluginObj) {
+			reason, message, err := checkDependencies(pmCtx)
+			if err != nil {
+				pmCtx.Info("check dependencies error", "error", err)
+				return ctrl.Result{}, err
+			}
+			setWaitingForDependencies(pmCtx, reason, message)
+			if message != "" {
+				pmCtx.Info("waiting for dependencies", "reason", reason, "message", message)
+				return ctrl.Result{}, PatchStatusAndFinalizers(pmCtx.Context, pmCtx.Client, pmCtx.ClusterPluginObj, orig)
+			}
+		}
+	} else if reason := uninstallUnavailable(pmCtx); reason != "" {
+		//集群已删除时无法uninstall,直接移除finalizer
+		pmCtx.Info("skip uninstall", "reason", reason)
+		pmCtx.Event(pmCtx.ClusterPluginObj, v13.EventTypeWarning, "SkipUninstall", reason)
+		if _, err := del.create(pmCtx); err != nil {
+			return ctrl.Result{}, err
+		}
+		del.updateClusterPlugin(pmCtx, nil)
+		return ctrl.Result{}, PatchStatusAndFinalizers(pmCtx.Context, pmCtx.Client, pmCtx.ClusterPluginObj, orig)
+	} else if pmCtx.ClusterPluginObj.GetStatus().UninstallStatus.JobName == "" {
+		dependents, err := uninstallingDependents(pmCtx)
+		if err != nil {
+			pmCtx.Info("list dependents error", "error", err)
+			return ctrl.Result{}, err
+		}
+		if len(dependents) > 0 {
+			pmCtx.Info("waiting for dependents uninstall", "dependents", dependents)
+			setWaitingForDependencies(pmCtx, "DependentsUninstalling", strings.Join(dependents, ","))
+			return ctrl.Result{}, PatchStatusAndFinalizers(pmCtx.Context, pmCtx.Client, pmCtx.ClusterPluginObj, orig)
+		}
+		setWaitingForDependencies(pmCtx, "", "")
+	}
+	mods := modules
+	if perCluster(pmCtx.ClusterPluginObj) {
+		mods = fanOutModules
+	}
+	total := len(mods)
+	for i, module := range mods {
 		modStr := fmt.Sprintf("[%v/%v]%s ", i+1, total, module.Name)
-		p, err := module.create(pmCtx)
+		j, err := module.create(pmCtx)
 		if err != nil {
-			pmCtx.Info(modStr+"create Cluster Plugin Pod error", "error", err)
+			pmCtx.Info(modStr+"create Cluster Plugin Job error", "error", err)
 			return ctrl.Result{}, err
 		}
-		module.updateClusterPlugin(pmCtx, p)
+		module.updateClusterPlugin(pmCtx, j)
 		pmCtx.Info(modStr + "updated Cluster Plugin")
-		if !module.next(pmCtx, p) {
+		if !module.next(pmCtx, j) {
 			break
 		}
 	}
-	if err := pmCtx.Client.Update(pmCtx.Context, pmCtx.ClusterPluginObj); err != nil {
+	if err := PatchStatusAndFinalizers(pmCtx.Context, pmCtx.Client, pmCtx.ClusterPluginObj, orig); err != nil {
 		pmCtx.Info("update Cluster Plugin error", "error", err)
 		return ctrl.Result{}, err
 	}
@@ -386,13 +660,118 @@ func reconcile(pmCtx *PluginModuleContext) (ctrl.Result, error) {
 	return ctrl.Result{}, nil
 }
 
-func getPodName(cp clusterv1.ClusterPluginObj, name string) string {
-	kind := strings.ToLower(cp.GetObjectKind().GroupVersionKind().Kind)
-	return fmt.Sprintf("%s-%s-%s", cp.GetName(), kind, name)
+// getPluginCluster 获取插件的目标集群,集群不存在时返回nil:插件未删除时等待集群创建,删除时跳过uninstall
+func getPluginCluster(ctx context.Context, cli client.Client, cp clusterv1.ClusterPluginObj, name string) (*clusterv1.Cluster, error) {
+	cluster := &clusterv1.Cluster{}
+	err := cli.Get(ctx, types.NamespacedName{
+		Namespace: cp.GetNamespace(),
+		Name:      name,
+	}, cluster)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// uninstallUnavailable 返回无法在目标集群上uninstall的原因,MultiClusterPlugin只在所有集群都不可用时跳过
+func uninstallUnavailable(ctx *PluginModuleContext) string {
+	clusters := ctx.Clusters
+	if clusters == nil {
+		clusters = []*clusterv1.Cluster{ctx.Cluster}
+	}
+	for _, c := range clusters {
+		if clusterInitialized(c) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("cluster %s not found or not initialized", ctx.ClusterPluginObj.GetClusterNames())
+}
+
+// waitingClusters 返回未满足spec.clusterReadiness的集群名
+func waitingClusters(ctx *PluginModuleContext) []string {
+	names := strings.Split(ctx.ClusterPluginObj.GetClusterNames(), ",")
+	clusters := ctx.Clusters
+	if clusters == nil {
+		clusters = []*clusterv1.Cluster{ctx.Cluster}
+	}
+	var waiting []string
+	for i, c := range clusters {
+		if !clusterReady(c, ctx.ClusterPluginObj.GetSpec().ClusterReadiness) {
+			waiting = append(waiting, names[i])
+		}
+	}
+	return waiting
+}
+
+// clusterReady 集群满足readiness策略,job需要挂载admin kubeconfig,未初始化的集群总是不满足
+func clusterReady(c *clusterv1.Cluster, policy clusterv1.ClusterReadinessPolicy) bool {
+	if !clusterInitialized(c) {
+		return false
+	}
+	switch policy {
+	case clusterv1.ClusterReadinessNone, clusterv1.ClusterReadinessInitialized:
+		return true
+	default:
+		return clusterv1.IsConditionTrue(c.Status.Conditions, clusterv1.ConditionReady)
+	}
+}
+
+// clusterInitialized 集群已生成admin kubeconfig,可以运行插件job
+func clusterInitialized(c *clusterv1.Cluster) bool {
+	return c != nil && c.Status.Init.AdminConfigName != ""
+}
+
+// getJobName job名称会作为pod的job-name label,超过63个字符时截断并追加hash保证唯一.
+// 从cache读取的对象没有TypeMeta,kind取自对象类型
+func getJobName(cp clusterv1.ClusterPluginObj, name string) string {
+	return truncateName(fmt.Sprintf("%s-%s-%s", cp.GetName(), strings.ToLower(pluginKind(cp)), name))
+}
+
+func truncateName(name string) string {
+	if len(name) <= maxJobNameLength {
+		return name
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(name)))[:8]
+	prefix := strings.TrimRight(name[:maxJobNameLength-len(hash)-1], "-.")
+	return prefix + "-" + hash
 }
 
 func (r *ClusterPluginReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&clusterv1.ClusterPlugin{}).Owns(&v13.Pod{}).
+		For(&clusterv1.ClusterPlugin{}).Owns(&batchv1.Job{}).
+		Watches(&source.Kind{Type: &clusterv1.Cluster{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.clusterToPlugins),
+		}).
+		Watches(&source.Kind{Type: &clusterv1.ClusterPlugin{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: pluginDependencyRequests(r.Client, clusterPluginKind),
+		}).
+		Watches(&source.Kind{Type: &clusterv1.MultiClusterPlugin{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: pluginDependencyRequests(r.Client, clusterPluginKind),
+		}).
+		Watches(&source.Kind{Type: &clusterv1.ClusterPluginTemplate{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.templateToPlugins),
+		}).
 		Complete(r)
 }
+
+// clusterToPlugins Cluster变化(如就绪)时触发其上的ClusterPlugin调谐
+func (r *ClusterPluginReconciler) clusterToPlugins(o handler.MapObject) []ctrl.Request {
+	list := &clusterv1.ClusterPluginList{}
+	if err := r.List(context.Background(), list, client.InNamespace(o.Meta.GetNamespace())); err != nil {
+		r.Log.Info("list ClusterPlugin error", "error", err)
+		return nil
+	}
+	var requests []ctrl.Request
+	for _, item := range list.Items {
+		if item.Spec.ClusterName == o.Meta.GetName() {
+			requests = append(requests, ctrl.Request{NamespacedName: types.NamespacedName{
+				Namespace: item.Namespace,
+				Name:      item.Name,
+			}})
+		}
+	}
+	return requests
+}
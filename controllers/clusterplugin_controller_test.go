@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"path"
+	"strings"
+	"testing"
+
+	clusterv1 "github.com/kok-stack/kok/api/v1"
+	v13 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestGetJobName(t *testing.T) {
+	long := strings.Repeat("a", 60)
+	multi := &clusterv1.MultiClusterPlugin{ObjectMeta: metav1.ObjectMeta{Name: "m"}}
+	tests := []struct {
+		name string
+		obj  clusterv1.ClusterPluginObj
+		job  string
+		want string
+	}{
+		{name: "cluster plugin", obj: testPlugin("p"), job: "install-12345678", want: "p-clusterplugin-install-12345678"},
+		{name: "multi cluster plugin", obj: multi, job: "uninstall-c", want: "m-multiclusterplugin-uninstall-c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getJobName(tt.obj, tt.job); got != tt.want {
+				t.Errorf("getJobName() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	a := getJobName(testPlugin(long), "install-a")
+	b := getJobName(testPlugin(long), "install-b")
+	if len(a) > maxJobNameLength || len(b) > maxJobNameLength {
+		t.Errorf("job name too long: %s, %s", a, b)
+	}
+	if a == b {
+		t.Errorf("truncated job names collide: %s", a)
+	}
+	if a != getJobName(testPlugin(long), "install-a") {
+		t.Error("truncated job name not stable")
+	}
+}
+
+func TestRenderJobClusterLabel(t *testing.T) {
+	a, b := testCluster("a"), testCluster("b")
+	multi := func(mode clusterv1.ExecutionMode) *clusterv1.MultiClusterPlugin {
+		cp := &clusterv1.MultiClusterPlugin{ObjectMeta: metav1.ObjectMeta{Name: "m", Namespace: "test"}}
+		cp.Spec.ExecutionMode = mode
+		cp.Spec.Install.Containers = []clusterv1.ClusterPluginPodContainer{{Name: "install"}}
+		cp.Status.Clusters = []clusterv1.ClusterPluginClusterStatus{{Name: "a"}, {Name: "b"}}
+		return cp
+	}
+	single := testPlugin("p")
+	single.Spec.ClusterName = "a"
+	tests := []struct {
+		name     string
+		obj      clusterv1.ClusterPluginObj
+		cluster  *clusterv1.Cluster
+		clusters []*clusterv1.Cluster
+		volumes  func(*PluginModuleContext, *v13.PodSpec) *v13.PodSpec
+		want     string
+	}{
+		{name: "cluster plugin", obj: single, cluster: a, volumes: clusterPluginAddVolume, want: "a"},
+		{name: "single mode", obj: multi(clusterv1.ExecutionModeSingle), clusters: []*clusterv1.Cluster{a, b}, volumes: multiClusterPluginAddVolumes, want: "m"},
+		{name: "per cluster member", obj: multi(clusterv1.ExecutionModePerCluster), clusters: []*clusterv1.Cluster{b}, volumes: multiClusterPluginAddVolumes, want: "b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &PluginModuleContext{ClusterPluginObj: tt.obj, Cluster: tt.cluster, Clusters: tt.clusters, AddVolumes: tt.volumes}
+			job := renderJob(ctx, "job", tt.obj.GetSpec().Install)
+			for _, labels := range []map[string]string{job.Labels, job.Spec.Template.Labels} {
+				if errs := validation.IsValidLabelValue(labels["cluster"]); len(errs) > 0 {
+					t.Errorf("invalid cluster label %q: %v", labels["cluster"], errs)
+				}
+				if labels["cluster"] != tt.want {
+					t.Errorf("cluster label = %s, want %s", labels["cluster"], tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAddKubeconfigMounts(t *testing.T) {
+	podTemplate := &v13.PodTemplateSpec{Spec: v13.PodSpec{
+		Volumes: []v13.Volume{{Name: "kubeconfig"}},
+		Containers: []v13.Container{{
+			Name:         "install",
+			VolumeMounts: []v13.VolumeMount{{Name: "kubeconfig", MountPath: "/root/.kube"}},
+		}},
+	}}
+	cp := testPlugin("p")
+	cp.Spec.ClusterName = "a"
+	cp.Spec.Install.PodTemplate = podTemplate
+	ctx := &PluginModuleContext{ClusterPluginObj: cp, Cluster: testCluster("a"), AddVolumes: clusterPluginAddVolume}
+	job := renderJob(ctx, "job", cp.Spec.Install)
+
+	names := map[string]bool{}
+	for _, v := range job.Spec.Template.Spec.Volumes {
+		if names[v.Name] {
+			t.Errorf("duplicate volume %s", v.Name)
+		}
+		names[v.Name] = true
+	}
+	paths := map[string]string{}
+	for _, m := range job.Spec.Template.Spec.Containers[0].VolumeMounts {
+		if _, ok := paths[path.Clean(m.MountPath)]; ok {
+			t.Errorf("duplicate mount path %s", m.MountPath)
+		}
+		paths[path.Clean(m.MountPath)] = m.Name
+	}
+	if paths["/root/.kube"] != "kubeconfig" || paths[path.Clean(MountPath)] != kubeconfigVolumeName {
+		t.Errorf("unexpected mounts %v", paths)
+	}
+}
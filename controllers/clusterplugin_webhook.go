@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"context"
+	clusterv1 "github.com/kok-stack/kok/api/v1"
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"net/http"
+	"reflect"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const ClusterPluginValidatePath = "/validate-cluster-kok-tanx-v1-clusterplugin"
+
+// +kubebuilder:webhook:path=/validate-cluster-kok-tanx-v1-clusterplugin,mutating=false,failurePolicy=fail,groups=cluster.kok.tanx,resources=clusterplugins,verbs=create;update,versions=v1,name=vclusterplugin.kb.io
+
+// ClusterPluginValidator 按ClusterPluginTemplate的参数定义校验ClusterPlugin的values
+type ClusterPluginValidator struct {
+	client.Client
+	decoder *admission.Decoder
+}
+
+func (v *ClusterPluginValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	cp := &clusterv1.ClusterPlugin{}
+	if err := v.decoder.Decode(req, cp); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if cp.Spec.Template == nil || !cp.DeletionTimestamp.IsZero() {
+		return admission.Allowed("")
+	}
+	//只在引用的模板或values变化时校验,模板更新后不阻塞已有插件的其他修改
+	if req.Operation == v1beta1.Update {
+		old := &clusterv1.ClusterPlugin{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if reflect.DeepEqual(old.Spec.Template, cp.Spec.Template) {
+			return admission.Allowed("")
+		}
+	}
+
+	tmpl := &clusterv1.ClusterPluginTemplate{}
+	err := v.Get(ctx, types.NamespacedName{Namespace: cp.Namespace, Name: cp.Spec.Template.Name}, tmpl)
+	if errors.IsNotFound(err) {
+		//模板可能稍后创建,由控制器在渲染时报告错误
+		return admission.Allowed("template not found")
+	}
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	errs := tmpl.ValidateValues(cp.Spec.Template.Values, field.NewPath("spec", "template", "values"))
+	if len(errs) > 0 {
+		gk := schema.GroupKind{Group: clusterv1.GroupVersion.Group, Kind: "ClusterPlugin"}
+		return admission.Denied(errors.NewInvalid(gk, cp.Name, errs).Error())
+	}
+	return admission.Allowed("")
+}
+
+func (v *ClusterPluginValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+const MultiClusterPluginValidatePath = "/validate-cluster-kok-tanx-v1-multiclusterplugin"
+
+// +kubebuilder:webhook:path=/validate-cluster-kok-tanx-v1-multiclusterplugin,mutating=false,failurePolicy=fail,groups=cluster.kok.tanx,resources=multiclusterplugins,verbs=create;update,versions=v1,name=vmulticlusterplugin.kb.io
+
+// MultiClusterPluginValidator rolloutStrategy只在PerCluster模式下生效,其他模式下拒绝设置
+type MultiClusterPluginValidator struct {
+	decoder *admission.Decoder
+}
+
+func (v *MultiClusterPluginValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	cp := &clusterv1.MultiClusterPlugin{}
+	if err := v.decoder.Decode(req, cp); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if !cp.DeletionTimestamp.IsZero() {
+		return admission.Allowed("")
+	}
+	//只在相关字段变化时校验,不阻塞已有插件的其他修改(如finalizers)
+	if req.Operation == v1beta1.Update {
+		old := &clusterv1.MultiClusterPlugin{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if old.Spec.ExecutionMode == cp.Spec.ExecutionMode && reflect.DeepEqual(old.Spec.RolloutStrategy, cp.Spec.RolloutStrategy) {
+			return admission.Allowed("")
+		}
+	}
+	if cp.Spec.RolloutStrategy != nil && cp.Spec.ExecutionMode != clusterv1.ExecutionModePerCluster {
+		errs := field.ErrorList{field.Invalid(field.NewPath("spec", "rolloutStrategy"), cp.Spec.ExecutionMode, "只支持executionMode PerCluster")}
+		gk := schema.GroupKind{Group: clusterv1.GroupVersion.Group, Kind: multiClusterPluginKind}
+		return admission.Denied(errors.NewInvalid(gk, cp.Name, errs).Error())
+	}
+	return admission.Allowed("")
+}
+
+func (v *MultiClusterPluginValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+const ClusterCredentialValidatePath = "/validate-cluster-kok-tanx-v1-clustercredential"
+
+// +kubebuilder:webhook:path=/validate-cluster-kok-tanx-v1-clustercredential,mutating=false,failurePolicy=fail,groups=cluster.kok.tanx,resources=clustercredentials,verbs=create;update,versions=v1,name=vclustercredential.kb.io
+
+// ClusterCredentialValidator 校验签发证书使用的用户名和组
+type ClusterCredentialValidator struct {
+	decoder *admission.Decoder
+}
+
+func (v *ClusterCredentialValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	cc := &clusterv1.ClusterCredential{}
+	if err := v.decoder.Decode(req, cc); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if !cc.DeletionTimestamp.IsZero() {
+		return admission.Allowed("")
+	}
+	if errs := validateCredential(cc); len(errs) > 0 {
+		gk := schema.GroupKind{Group: clusterv1.GroupVersion.Group, Kind: "ClusterCredential"}
+		return admission.Denied(errors.NewInvalid(gk, cc.Name, errs).Error())
+	}
+	return admission.Allowed("")
+}
+
+func (v *ClusterCredentialValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	v1 "github.com/kok-stack/kok/api/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v12 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"time"
+)
+
+const (
+	defaultSnapshotSize = "1Gi"
+	snapshotMountPath   = "/snapshot"
+)
+
+var (
+	snapshotCheckPeriod         = time.Second * 10
+	snapshotBackoffLimit  int32 = 3
+	snapshotActiveSeconds int64 = 600
+)
+
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create
+
+// retainClusterResources Retain策略下解除etcd集群,secrets及插件与Cluster的owner关系,避免被级联删除
+func retainClusterResources(ctx *ModuleContext) error {
+	etcd := &v1beta2.EtcdCluster{}
+	err := ctx.Get(ctx, types.NamespacedName{Namespace: ctx.Namespace, Name: etcdName(ctx.Cluster)}, etcd)
+	if client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	if err == nil {
+		if err := removeOwner(ctx, etcd); err != nil {
+			return err
+		}
+	}
+
+	secrets := &v12.SecretList{}
+	if err := ctx.List(ctx, secrets, client.InNamespace(ctx.Namespace)); err != nil {
+		return err
+	}
+	for i := range secrets.Items {
+		if err := removeOwner(ctx, &secrets.Items[i]); err != nil {
+			return err
+		}
+	}
+	//spec.plugins创建的插件同样保留,不做uninstall
+	plugins := &v1.ClusterPluginList{}
+	if err := ctx.List(ctx, plugins, client.InNamespace(ctx.Namespace)); err != nil {
+		return err
+	}
+	for i := range plugins.Items {
+		if err := removeOwner(ctx, &plugins.Items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteClusterPlugins 删除目标为该集群的ClusterPlugin,并等待MultiClusterPlugin对该集群uninstall,返回是否已全部完成.
+// 插件控制器按依赖的相反顺序执行uninstall,需在集群模块删除前完成.集群未初始化时插件控制器跳过uninstall
+func deleteClusterPlugins(ctx *ModuleContext) (bool, error) {
+	plugins := &v1.ClusterPluginList{}
+	if err := ctx.List(ctx, plugins, client.InNamespace(ctx.Namespace)); err != nil {
+		return false, err
+	}
+	done := true
+	for i := range plugins.Items {
+		plugin := &plugins.Items[i]
+		if plugin.Spec.ClusterName != ctx.Name {
+			continue
+		}
+		done = false
+		if !plugin.DeletionTimestamp.IsZero() {
+			continue
+		}
+		ctx.Recorder.Event(ctx, v12.EventTypeNormal, "DeletePlugin", plugin.Name)
+		if err := ctx.Delete(ctx, plugin); client.IgnoreNotFound(err) != nil {
+			return false, err
+		}
+	}
+	//MultiClusterPlugin不删除,集群删除后不再作为目标,uninstall完成后从status.clusters移除
+	multi := &v1.MultiClusterPluginList{}
+	if err := ctx.List(ctx, multi, client.InNamespace(ctx.Namespace)); err != nil {
+		return false, err
+	}
+	for _, plugin := range multi.Items {
+		for _, member := range plugin.Status.Clusters {
+			if member.Name == ctx.Name {
+				ctx.Info("waiting for MultiClusterPlugin uninstall", "plugin", plugin.Name)
+				done = false
+			}
+		}
+	}
+	return done, nil
+}
+
+func removeOwner(ctx *ModuleContext, obj patchObject) error {
+	refs := obj.GetOwnerReferences()
+	kept := make([]metav1.OwnerReference, 0, len(refs))
+	for _, ref := range refs {
+		if ref.UID != ctx.UID {
+			kept = append(kept, ref)
+		}
+	}
+	if len(kept) == len(refs) {
+		return nil
+	}
+	base := obj.DeepCopyObject()
+	obj.SetOwnerReferences(kept)
+	ctx.Info("retain resource", "name", obj.GetName())
+	return client.IgnoreNotFound(ctx.Patch(ctx, obj, client.MergeFrom(base)))
+}
+
+// snapshotEtcd Snapshot策略下删除前通过job将etcd快照保存到不随Cluster删除的pvc,返回快照是否完成
+func snapshotEtcd(ctx *ModuleContext) (bool, error) {
+	status := &ctx.Status.Deletion
+	etcd := &v1beta2.EtcdCluster{}
+	err := ctx.Get(ctx, types.NamespacedName{Namespace: ctx.Namespace, Name: etcdName(ctx.Cluster)}, etcd)
+	if errors.IsNotFound(err) || (err == nil && etcd.Status.ServiceName == "") {
+		ctx.Info("etcd not found, skip snapshot")
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	name := fmt.Sprintf("%s-etcd-snapshot", ctx.Name)
+	if err := createSnapshotClaim(ctx, name); err != nil {
+		return false, err
+	}
+	status.SnapshotClaimName = name
+
+	job := &batchv1.Job{}
+	err = ctx.Get(ctx, types.NamespacedName{Namespace: ctx.Namespace, Name: name}, job)
+	if errors.IsNotFound(err) {
+		job = renderSnapshotJob(ctx.Cluster, etcd, name)
+		if err := controllerutil.SetControllerReference(ctx.Cluster, job, ctx.Scheme); err != nil {
+			return false, err
+		}
+		ctx.Recorder.Event(ctx, v12.EventTypeNormal, "Snapshot", name)
+		if err := ctx.Create(ctx, job); err != nil && !errors.IsAlreadyExists(err) {
+			return false, err
+		}
+	} else if err != nil {
+		return false, err
+	}
+	status.SnapshotJobName = job.Name
+	status.SnapshotStatus = job.Status
+
+	if jobCondition(job.Status, batchv1.JobFailed) {
+		return false, fmt.Errorf("etcd snapshot job %s failed", job.Name)
+	}
+	return jobCondition(job.Status, batchv1.JobComplete), nil
+}
+
+func createSnapshotClaim(ctx *ModuleContext, name string) error {
+	err := ctx.Get(ctx, types.NamespacedName{Namespace: ctx.Namespace, Name: name}, &v12.PersistentVolumeClaim{})
+	if !errors.IsNotFound(err) {
+		return err
+	}
+	size := ctx.Spec.Snapshot.Size
+	if size == "" {
+		size = defaultSnapshotSize
+	}
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil {
+		return err
+	}
+	//不设置owner,pvc在Cluster删除后保留
+	pvc := &v12.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ctx.Namespace,
+			Labels: map[string]string{
+				"cluster": ctx.Name,
+			},
+		},
+		Spec: v12.PersistentVolumeClaimSpec{
+			AccessModes:      []v12.PersistentVolumeAccessMode{v12.ReadWriteOnce},
+			StorageClassName: ctx.Spec.Snapshot.StorageClassName,
+			Resources: v12.ResourceRequirements{
+				Requests: v12.ResourceList{v12.ResourceStorage: quantity},
+			},
+		},
+	}
+	ctx.Recorder.Event(ctx, v12.EventTypeNormal, "Creating", name)
+	err = ctx.Create(ctx, pvc)
+	if errors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+func renderSnapshotJob(c *v1.Cluster, etcd *v1beta2.EtcdCluster, name string) *batchv1.Job {
+	labels := map[string]string{
+		"cluster": c.Name,
+		"app":     name,
+	}
+	endpoint := fmt.Sprintf("https://%s:%v", etcd.Status.ServiceName, etcd.Status.ClientPort)
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: c.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          &snapshotBackoffLimit,
+			ActiveDeadlineSeconds: &snapshotActiveSeconds,
+			Template: v12.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   name,
+					Labels: labels,
+				},
+				Spec: v12.PodSpec{
+					Containers: []v12.Container{{
+						Name:  "snapshot",
+						Image: fmt.Sprintf("%s:v%s", etcd.Spec.Repository, etcd.Spec.Version),
+						Command: []string{"sh", "-c", fmt.Sprintf("etcdctl --endpoints=%s "+
+							"--cacert=/pki/etcd/etcd-client-ca.crt --cert=/pki/etcd/etcd-client.crt --key=/pki/etcd/etcd-client.key "+
+							"snapshot save %s/snapshot-$(date +%%Y%%m%%d%%H%%M%%S).db", endpoint, snapshotMountPath)},
+						Env: []v12.EnvVar{{
+							Name:  "ETCDCTL_API",
+							Value: "3",
+						}},
+						VolumeMounts: []v12.VolumeMount{{
+							Name:      "etcd-pki",
+							MountPath: "/pki/etcd",
+							ReadOnly:  true,
+						}, {
+							Name:      "snapshot",
+							MountPath: snapshotMountPath,
+						}},
+					}},
+					Volumes: []v12.Volume{{
+						Name: "etcd-pki",
+						VolumeSource: v12.VolumeSource{
+							Secret: &v12.SecretVolumeSource{SecretName: c.Status.Init.EtcdPkiClientName},
+						},
+					}, {
+						Name: "snapshot",
+						VolumeSource: v12.VolumeSource{
+							PersistentVolumeClaim: &v12.PersistentVolumeClaimVolumeSource{ClaimName: name},
+						},
+					}},
+					RestartPolicy: v12.RestartPolicyNever,
+				},
+			},
+		},
+	}
+}
+
+func etcdName(c *v1.Cluster) string {
+	return fmt.Sprintf("%s-etcd", c.Name)
+}
+
+func jobCondition(status batchv1.JobStatus, t batchv1.JobConditionType) bool {
+	for _, condition := range status.Conditions {
+		if condition.Type == t && condition.Status == v12.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	v1 "github.com/kok-stack/kok/api/v1"
+	v12 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
+)
+
+const adminConfigKey = "admin.config"
+
+var guestClientTimeout = time.Second * 10
+
+// NewGuestClient 使用init job生成的admin.config访问guest集群
+func NewGuestClient(ctx context.Context, cli client.Client, c *v1.Cluster) (kubernetes.Interface, error) {
+	if c.Status.Init.AdminConfigName == "" {
+		return nil, fmt.Errorf("cluster %s/%s admin config not ready", c.Namespace, c.Name)
+	}
+	secret := &v12.Secret{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: c.Namespace, Name: c.Status.Init.AdminConfigName}, secret); err != nil {
+		return nil, err
+	}
+	config, err := clientcmd.RESTConfigFromKubeConfig(secret.Data[adminConfigKey])
+	if err != nil {
+		return nil, err
+	}
+	config.Timeout = guestClientTimeout
+	return kubernetes.NewForConfig(config)
+}
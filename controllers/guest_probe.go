@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	v1 "github.com/kok-stack/kok/api/v1"
+	v12 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+	"time"
+)
+
+// GuestProbePeriod 集群就绪后定期探测guest集群的间隔
+var GuestProbePeriod = time.Minute
+
+// GuestProbePageSize 探测时分页list guest资源的每页数量,避免大集群一次拉取全部对象
+var GuestProbePageSize int64 = 500
+
+// ProbeGuest 探测guest集群并将结果写入status.guest,/readyz检查失败时返回error
+func ProbeGuest(ctx context.Context, cli client.Client, c *v1.Cluster) error {
+	now := metav1.Now()
+	status := &c.Status.Guest
+	status.LastProbeTime = &now
+	status.Readyz = false
+
+	guest, err := NewGuestClient(ctx, cli, c)
+	if err != nil {
+		status.Message = err.Error()
+		return err
+	}
+	body, err := guest.Discovery().RESTClient().Get().AbsPath("/readyz").DoRaw()
+	if err != nil {
+		status.Message = err.Error()
+		return err
+	}
+	if string(body) != "ok" {
+		status.Message = string(body)
+		return fmt.Errorf("readyz: %s", body)
+	}
+	status.Readyz = true
+
+	//以下为统计信息,失败只记录不影响就绪
+	var messages []string
+	if version, err := guest.Discovery().ServerVersion(); err != nil {
+		messages = append(messages, err.Error())
+	} else {
+		status.Version = version.GitVersion
+	}
+	if css, err := guest.CoreV1().ComponentStatuses().List(metav1.ListOptions{}); err != nil {
+		messages = append(messages, err.Error())
+	} else {
+		status.ComponentStatuses = make([]v1.ClusterComponentStatus, 0, len(css.Items))
+		for _, cs := range css.Items {
+			s := v1.ClusterComponentStatus{Name: cs.Name}
+			for _, condition := range cs.Conditions {
+				if condition.Type == v12.ComponentHealthy {
+					s.Healthy = condition.Status == v12.ConditionTrue
+					s.Message = condition.Message + condition.Error
+				}
+			}
+			status.ComponentStatuses = append(status.ComponentStatuses, s)
+		}
+	}
+	var nodes, readyNodes int32
+	err = listGuestPages(func(opts metav1.ListOptions) (metav1.ListMeta, int, error) {
+		list, err := guest.CoreV1().Nodes().List(opts)
+		if err != nil {
+			return metav1.ListMeta{}, 0, err
+		}
+		for _, node := range list.Items {
+			for _, condition := range node.Status.Conditions {
+				if condition.Type == v12.NodeReady && condition.Status == v12.ConditionTrue {
+					readyNodes++
+				}
+			}
+		}
+		nodes += int32(len(list.Items))
+		return list.ListMeta, len(list.Items), nil
+	})
+	if err != nil {
+		messages = append(messages, err.Error())
+	} else {
+		status.Nodes = nodes
+		status.ReadyNodes = readyNodes
+	}
+	if count, err := countGuest(func(opts metav1.ListOptions) (metav1.ListMeta, int, error) {
+		list, err := guest.CoreV1().Namespaces().List(opts)
+		if err != nil {
+			return metav1.ListMeta{}, 0, err
+		}
+		return list.ListMeta, len(list.Items), nil
+	}); err != nil {
+		messages = append(messages, err.Error())
+	} else {
+		status.Namespaces = count
+	}
+	if count, err := countGuest(func(opts metav1.ListOptions) (metav1.ListMeta, int, error) {
+		list, err := guest.CoreV1().Pods(metav1.NamespaceAll).List(opts)
+		if err != nil {
+			return metav1.ListMeta{}, 0, err
+		}
+		return list.ListMeta, len(list.Items), nil
+	}); err != nil {
+		messages = append(messages, err.Error())
+	} else {
+		status.Pods = count
+	}
+	status.Message = strings.Join(messages, "; ")
+	return nil
+}
+
+type guestListFunc func(opts metav1.ListOptions) (metav1.ListMeta, int, error)
+
+// listGuestPages 按GuestProbePageSize分页list,直到没有continue
+func listGuestPages(list guestListFunc) error {
+	opts := metav1.ListOptions{Limit: GuestProbePageSize}
+	for {
+		meta, _, err := list(opts)
+		if err != nil {
+			return err
+		}
+		if meta.Continue == "" {
+			return nil
+		}
+		opts.Continue = meta.Continue
+	}
+}
+
+// countGuest 只统计数量,优先使用apiserver返回的remainingItemCount,不支持时退化为分页计数
+func countGuest(list guestListFunc) (int32, error) {
+	meta, n, err := list(metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return 0, err
+	}
+	if meta.Continue == "" {
+		return int32(n), nil
+	}
+	if meta.RemainingItemCount != nil {
+		return int32(int64(n) + *meta.RemainingItemCount), nil
+	}
+	total := int32(n)
+	opts := metav1.ListOptions{Limit: GuestProbePageSize, Continue: meta.Continue}
+	for opts.Continue != "" {
+		meta, n, err = list(opts)
+		if err != nil {
+			return 0, err
+		}
+		total += int32(n)
+		opts.Continue = meta.Continue
+	}
+	return total, nil
+}
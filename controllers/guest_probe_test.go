@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pagedGuestList 模拟apiserver分页,remaining为false时不返回remainingItemCount
+func pagedGuestList(total int, remaining bool, calls *int) guestListFunc {
+	return func(opts metav1.ListOptions) (metav1.ListMeta, int, error) {
+		*calls++
+		start := 0
+		if opts.Continue != "" {
+			fmt.Sscanf(opts.Continue, "%d", &start)
+		}
+		end := start + int(opts.Limit)
+		if opts.Limit == 0 || end > total {
+			end = total
+		}
+		meta := metav1.ListMeta{}
+		if end < total {
+			meta.Continue = fmt.Sprint(end)
+			if remaining {
+				left := int64(total - end)
+				meta.RemainingItemCount = &left
+			}
+		}
+		return meta, end - start, nil
+	}
+}
+
+func TestCountGuest(t *testing.T) {
+	defer func(size int64) { GuestProbePageSize = size }(GuestProbePageSize)
+	GuestProbePageSize = 10
+
+	tests := []struct {
+		name      string
+		total     int
+		remaining bool
+		calls     int
+	}{
+		{name: "empty", total: 0, calls: 1},
+		{name: "remaining item count", total: 25, remaining: true, calls: 1},
+		{name: "paged", total: 25, calls: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			got, err := countGuest(pagedGuestList(tt.total, tt.remaining, &calls))
+			if err != nil || got != int32(tt.total) || calls != tt.calls {
+				t.Errorf("countGuest() = %d, %v with %d calls, want %d with %d calls", got, err, calls, tt.total, tt.calls)
+			}
+		})
+	}
+
+	calls := 0
+	if err := listGuestPages(pagedGuestList(25, false, &calls)); err != nil || calls != 3 {
+		t.Errorf("listGuestPages() = %v with %d calls, want 3", err, calls)
+	}
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	clusterv1 "github.com/kok-stack/kok/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+// 控制器测试共用的fixture,对象都在test命名空间
+
+func testScheme(t *testing.T) *runtime.Scheme {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := clusterv1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// testCluster 已初始化的集群,可以直接运行插件job
+func testCluster(name string) *clusterv1.Cluster {
+	c := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test"}}
+	c.Status.Init.AdminConfigName = name + "-admin-config"
+	return c
+}
+
+// testPlugin 指定集群为c的ClusterPlugin
+func testPlugin(name string, deps ...clusterv1.ClusterPluginReference) *clusterv1.ClusterPlugin {
+	return &clusterv1.ClusterPlugin{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test"},
+		Spec: clusterv1.ClusterPluginSpec{
+			ClusterName:            "c",
+			CLusterPluginSpecInner: clusterv1.CLusterPluginSpecInner{DependsOn: deps},
+		},
+	}
+}
+
+func ref(kind, name string) clusterv1.ClusterPluginReference {
+	return clusterv1.ClusterPluginReference{Kind: kind, Name: name}
+}
+
+// testCert 生成测试证书,parent为空时自签名
+func testCert(t *testing.T, cn string, isCA bool, usages []x509.ExtKeyUsage, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           usages,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
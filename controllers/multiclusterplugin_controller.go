@@ -19,15 +19,22 @@ package controllers
 import (
 	"context"
 	"fmt"
+	batchv1 "k8s.io/api/batch/v1"
 	v13 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	"path"
+	"sort"
+	"strings"
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	clusterv1 "github.com/kok-stack/kok/api/v1"
 )
@@ -45,7 +52,6 @@ type MultiClusterPluginReconciler struct {
 
 func (r *MultiClusterPluginReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
-	namespace := req.Namespace
 	log := r.Log.WithValues("multi_cluster_plugin", req.NamespacedName)
 
 	cp := &clusterv1.MultiClusterPlugin{}
@@ -54,16 +60,27 @@ func (r *MultiClusterPluginReconciler) Reconcile(req ctrl.Request) (ctrl.Result,
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	clusters := make([]*clusterv1.Cluster, len(cp.Spec.Clusters))
-	for i, name := range cp.Spec.Clusters {
-		cluster := &clusterv1.Cluster{}
-		if err := r.Client.Get(ctx, types.NamespacedName{
-			Namespace: namespace,
-			Name:      name,
-		}, cluster); err != nil {
-			return ctrl.Result{}, err
+	orig := cp.DeepCopy()
+	members, err := r.resolveClusters(ctx, cp)
+	if err != nil {
+		log.Info("resolve clusters error", "error", err)
+		return ctrl.Result{}, err
+	}
+	//删除时保持已解析的目标集群,对其执行uninstall
+	if cp.DeletionTimestamp.IsZero() || len(cp.Status.Clusters) == 0 {
+		updateMembers(cp, members)
+	}
+
+	names := cp.GetClusterNames()
+	clusters := make([]*clusterv1.Cluster, 0)
+	if names != "" {
+		for _, name := range strings.Split(names, ",") {
+			cluster, err := getPluginCluster(ctx, r.Client, cp, name)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			clusters = append(clusters, cluster)
 		}
-		clusters[i] = cluster
 	}
 
 	pmCtx := &PluginModuleContext{
@@ -75,69 +92,228 @@ func (r *MultiClusterPluginReconciler) Reconcile(req ctrl.Request) (ctrl.Result,
 		ClusterPluginObj: cp,
 		Clusters:         clusters,
 		AddVolumes:       multiClusterPluginAddVolumes,
+		Original:         orig,
+	}
+	if err := uninstallRemovedClusters(pmCtx); err != nil {
+		log.Info("uninstall removed clusters error", "error", err)
+		return ctrl.Result{}, err
+	}
+	if len(clusters) == 0 && cp.DeletionTimestamp.IsZero() {
+		log.Info("no matching clusters")
+		clusterv1.SetCondition(&cp.Status.Conditions, clusterv1.ConditionWaitingForCluster, v13.ConditionTrue, "NoMatchingClusters", "")
+		return ctrl.Result{}, PatchStatusAndFinalizers(ctx, r.Client, cp, orig)
 	}
 	return reconcile(pmCtx)
 }
 
+// resolveClusters 返回spec.clusters及spec.clusterSelector选中的集群名,正在删除的集群不再作为目标,
+// 由uninstallRemovedClusters在集群删除等待插件期间执行uninstall
+func (r *MultiClusterPluginReconciler) resolveClusters(ctx context.Context, cp *clusterv1.MultiClusterPlugin) ([]string, error) {
+	var names []string
+	for _, name := range cp.Spec.Clusters {
+		cluster := &clusterv1.Cluster{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: cp.Namespace, Name: name}, cluster)
+		if client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		//不存在的集群保留,等待集群创建
+		if err != nil || cluster.DeletionTimestamp.IsZero() {
+			names = append(names, name)
+		}
+	}
+	if cp.Spec.ClusterSelector == nil {
+		return names, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(cp.Spec.ClusterSelector)
+	if err != nil {
+		return nil, err
+	}
+	list := &clusterv1.ClusterList{}
+	if err := r.List(ctx, list, client.InNamespace(cp.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	var selected []string
+	for _, c := range list.Items {
+		if c.DeletionTimestamp.IsZero() && !containsString(names, c.Name) {
+			selected = append(selected, c.Name)
+		}
+	}
+	sort.Strings(selected)
+	return append(names, selected...), nil
+}
+
+// updateMembers 按解析结果更新status.clusters,不再匹配的集群标记为removing
+func updateMembers(cp *clusterv1.MultiClusterPlugin, names []string) {
+	members := make([]clusterv1.ClusterPluginClusterStatus, 0, len(names))
+	for _, name := range names {
+		member := clusterv1.ClusterPluginClusterStatus{Name: name}
+		//保留已有集群的运行状态,再次匹配的集群重新install
+		for _, m := range cp.Status.Clusters {
+			if m.Name == name && !m.Removing {
+				member = m
+			}
+		}
+		members = append(members, member)
+	}
+	for _, member := range cp.Status.Clusters {
+		if containsString(names, member.Name) {
+			continue
+		}
+		member.Removing = true
+		members = append(members, member)
+	}
+	if len(members) == 0 {
+		members = nil
+	}
+	cp.Status.Clusters = members
+}
+
+// uninstallRemovedClusters 对不再匹配的集群单独运行uninstall job,结束后从status中移除
+func uninstallRemovedClusters(ctx *PluginModuleContext) error {
+	status := ctx.ClusterPluginObj.GetStatus()
+	spec := ctx.ClusterPluginObj.GetSpec().Uninstall
+	members := make([]clusterv1.ClusterPluginClusterStatus, 0, len(status.Clusters))
+	for _, member := range status.Clusters {
+		if !member.Removing {
+			members = append(members, member)
+			continue
+		}
+		cluster := &clusterv1.Cluster{}
+		err := ctx.Get(ctx, types.NamespacedName{Namespace: ctx.ClusterPluginObj.GetNamespace(), Name: member.Name}, cluster)
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		//集群已删除,未初始化或没有uninstall时直接移除
+		if err != nil || !clusterInitialized(cluster) || spec.IsEmpty() || !memberInstalled(ctx.ClusterPluginObj, member) {
+			ctx.Event(ctx.ClusterPluginObj, v13.EventTypeNormal, "ClusterRemoved", member.Name)
+			continue
+		}
+		//Retain策略删除的集群不等待插件,无法保证uninstall完成
+		if !cluster.DeletionTimestamp.IsZero() && cluster.Spec.DeletionPolicy == clusterv1.DeletionPolicyRetain {
+			ctx.Event(ctx.ClusterPluginObj, v13.EventTypeWarning, "SkipUninstall", fmt.Sprintf("cluster %s is being deleted with Retain policy", member.Name))
+			continue
+		}
+		sub := *ctx
+		sub.Clusters = []*clusterv1.Cluster{cluster}
+		name := getJobName(ctx.ClusterPluginObj, "uninstall-"+member.Name)
+		j, err := getOrCreateJob(&sub, name, spec, hashPluginSpec(spec), member.UninstallStatus)
+		if err != nil {
+			return err
+		}
+		setJobStatus(&member.UninstallStatus, j)
+		if j != nil && !jobFinished(member.UninstallStatus.Status) {
+			members = append(members, member)
+			continue
+		}
+		ctx.Event(ctx.ClusterPluginObj, v13.EventTypeNormal, "ClusterRemoved", member.Name)
+		//删除已结束的job,集群再次匹配后移除时重新运行
+		if j != nil {
+			policy := metav1.DeletePropagationBackground
+			if err := ctx.Client.Delete(ctx, j, &client.DeleteOptions{PropagationPolicy: &policy}); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		}
+	}
+	if len(members) == 0 {
+		members = nil
+	}
+	status.Clusters = members
+	ctx.ClusterPluginObj.UpdateStatus(status)
+	return nil
+}
+
+// memberInstalled 集群上是否运行过install,Single模式下以整体install为准
+func memberInstalled(obj clusterv1.ClusterPluginObj, member clusterv1.ClusterPluginClusterStatus) bool {
+	if perCluster(obj) {
+		return member.InstallStatus.JobName != ""
+	}
+	return obj.GetStatus().InstallStatus.JobName != ""
+}
+
+// multiClusterPluginAddVolumes 将各集群的kubeconfig投射到同一个卷,路径为<cluster>/config
 func multiClusterPluginAddVolumes(ctx *PluginModuleContext, spec *v13.PodSpec) *v13.PodSpec {
-	plugin := ctx.ClusterPluginObj.(*clusterv1.MultiClusterPlugin)
 	cs := ctx.Clusters
-	clusters := plugin.Spec.Clusters
+	addKubeconfigMounts(spec, MountPath)
 
-	mount := []v13.VolumeMount{
-		{
-			Name:      "kubeconfig",
-			ReadOnly:  true,
-			MountPath: MountPath,
-		},
-	}
-	for i, container := range spec.InitContainers {
-		if len(container.VolumeMounts) > 0 {
-			container.VolumeMounts = append(container.VolumeMounts, mount...)
-		} else {
-			container.VolumeMounts = mount
-		}
-		spec.Containers[i] = container
-	}
-	for i, container := range spec.Containers {
-		if len(container.VolumeMounts) > 0 {
-			container.VolumeMounts = append(container.VolumeMounts, mount...)
-		} else {
-			container.VolumeMounts = mount
-		}
-		spec.Containers[i] = container
-	}
-
-	volumes := make([]v13.Volume, len(clusters))
-	for i, cluster := range clusters {
-		fmt.Println(cluster)
-		volume := v13.Volume{
-			Name: "kubeconfig",
-			VolumeSource: v13.VolumeSource{
-				Secret: &v13.SecretVolumeSource{
-					SecretName: cs[i].Status.Init.AdminConfigName,
-					Items: []v13.KeyToPath{
-						{
-							Key:  "admin.config",
-							Path: path.Join(cluster, "config"),
-						},
+	sources := make([]v13.VolumeProjection, 0, len(cs))
+	for _, cluster := range cs {
+		if !clusterInitialized(cluster) {
+			continue
+		}
+		sources = append(sources, v13.VolumeProjection{
+			Secret: &v13.SecretProjection{
+				LocalObjectReference: v13.LocalObjectReference{Name: cluster.Status.Init.AdminConfigName},
+				Items: []v13.KeyToPath{
+					{
+						Key:  "admin.config",
+						Path: path.Join(cluster.Name, "config"),
 					},
 				},
 			},
-		}
-		volumes[i] = volume
+		})
+	}
+	volume := v13.Volume{
+		Name: kubeconfigVolumeName,
+		VolumeSource: v13.VolumeSource{
+			Projected: &v13.ProjectedVolumeSource{Sources: sources},
+		},
 	}
 
 	if len(spec.Volumes) == 0 {
-		spec.Volumes = volumes
+		spec.Volumes = []v13.Volume{volume}
 	} else {
-		spec.Volumes = append(spec.Volumes, volumes...)
+		spec.Volumes = append(spec.Volumes, volume)
 	}
 	return spec
 }
 
 func (r *MultiClusterPluginReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&clusterv1.MultiClusterPlugin{}).
+		For(&clusterv1.MultiClusterPlugin{}).Owns(&batchv1.Job{}).
+		Watches(&source.Kind{Type: &clusterv1.Cluster{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.clusterToPlugins),
+		}).
+		Watches(&source.Kind{Type: &clusterv1.ClusterPlugin{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: pluginDependencyRequests(r.Client, multiClusterPluginKind),
+		}).
+		Watches(&source.Kind{Type: &clusterv1.MultiClusterPlugin{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: pluginDependencyRequests(r.Client, multiClusterPluginKind),
+		}).
 		Complete(r)
 }
+
+// clusterToPlugins Cluster变化(如就绪)时触发包含该集群的MultiClusterPlugin调谐
+func (r *MultiClusterPluginReconciler) clusterToPlugins(o handler.MapObject) []ctrl.Request {
+	list := &clusterv1.MultiClusterPluginList{}
+	if err := r.List(context.Background(), list, client.InNamespace(o.Meta.GetNamespace())); err != nil {
+		r.Log.Info("list MultiClusterPlugin error", "error", err)
+		return nil
+	}
+	var requests []ctrl.Request
+	for _, item := range list.Items {
+		if targetsCluster(&item, o.Meta) {
+			requests = append(requests, ctrl.Request{NamespacedName: types.NamespacedName{
+				Namespace: item.Namespace,
+				Name:      item.Name,
+			}})
+		}
+	}
+	return requests
+}
+
+// targetsCluster 集群在spec.clusters中,被clusterSelector选中,或在status中(可能不再匹配)
+func targetsCluster(cp *clusterv1.MultiClusterPlugin, cluster metav1.Object) bool {
+	if containsString(cp.Spec.Clusters, cluster.GetName()) {
+		return true
+	}
+	for _, member := range cp.Status.Clusters {
+		if member.Name == cluster.GetName() {
+			return true
+		}
+	}
+	if cp.Spec.ClusterSelector == nil {
+		return false
+	}
+	selector, err := metav1.LabelSelectorAsSelector(cp.Spec.ClusterSelector)
+	return err == nil && selector.Matches(labels.Set(cluster.GetLabels()))
+}
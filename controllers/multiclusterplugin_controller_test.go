@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	clusterv1 "github.com/kok-stack/kok/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestUpdateMembers(t *testing.T) {
+	installed := clusterv1.ClusterPluginPodStatus{JobName: "install-a"}
+	tests := []struct {
+		name    string
+		members []clusterv1.ClusterPluginClusterStatus
+		names   []string
+		want    []clusterv1.ClusterPluginClusterStatus
+	}{
+		{
+			name:  "new clusters",
+			names: []string{"a", "b"},
+			want:  []clusterv1.ClusterPluginClusterStatus{{Name: "a"}, {Name: "b"}},
+		},
+		{
+			name:    "keep status of matched clusters",
+			members: []clusterv1.ClusterPluginClusterStatus{{Name: "a", InstallStatus: installed}},
+			names:   []string{"b", "a"},
+			want:    []clusterv1.ClusterPluginClusterStatus{{Name: "b"}, {Name: "a", InstallStatus: installed}},
+		},
+		{
+			name:    "mark unmatched clusters removing",
+			members: []clusterv1.ClusterPluginClusterStatus{{Name: "a", InstallStatus: installed}, {Name: "b"}},
+			names:   []string{"b"},
+			want:    []clusterv1.ClusterPluginClusterStatus{{Name: "b"}, {Name: "a", InstallStatus: installed, Removing: true}},
+		},
+		{
+			//再次匹配的集群重新install
+			name:    "rematched cluster starts over",
+			members: []clusterv1.ClusterPluginClusterStatus{{Name: "a", InstallStatus: installed, Removing: true}},
+			names:   []string{"a"},
+			want:    []clusterv1.ClusterPluginClusterStatus{{Name: "a"}},
+		},
+		{
+			name:    "no clusters",
+			members: nil,
+			names:   nil,
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cp := &clusterv1.MultiClusterPlugin{}
+			cp.Status.Clusters = tt.members
+			updateMembers(cp, tt.names)
+			if !reflect.DeepEqual(cp.Status.Clusters, tt.want) {
+				t.Errorf("clusters = %+v, want %+v", cp.Status.Clusters, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveClusters(t *testing.T) {
+	labeled := func(name string) *clusterv1.Cluster {
+		c := testCluster(name)
+		c.Labels = map[string]string{"env": "prod"}
+		return c
+	}
+	deleting := labeled("deleting")
+	deleting.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	deleting.Finalizers = []string{"test"}
+	other := testCluster("other")
+
+	tests := []struct {
+		name     string
+		clusters []string
+		selector *metav1.LabelSelector
+		want     []string
+	}{
+		{name: "names", clusters: []string{"b", "missing"}, want: []string{"b", "missing"}},
+		{name: "deleting named cluster", clusters: []string{"deleting"}, want: nil},
+		{name: "selector", selector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}, want: []string{"a", "b"}},
+		{
+			name:     "names first without duplicates",
+			clusters: []string{"b", "other"},
+			selector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+			want:     []string{"b", "other", "a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cp := &clusterv1.MultiClusterPlugin{ObjectMeta: metav1.ObjectMeta{Name: "m", Namespace: "test"}}
+			cp.Spec.Clusters = tt.clusters
+			cp.Spec.ClusterSelector = tt.selector
+			r := &MultiClusterPluginReconciler{Client: fake.NewFakeClientWithScheme(testScheme(t), labeled("b"), labeled("a"), deleting, other)}
+			names, err := r.resolveClusters(context.Background(), cp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("resolveClusters() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"fmt"
+	clusterv1 "github.com/kok-stack/kok/api/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v13 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// PerCluster模式下每个目标集群单独运行install,uninstall job,结果记录在status.clusters
+var fanOutModules = []*ClusterPluginModule{fanOutInstall, fanOutUninstall, del}
+
+var fanOutInstall = &ClusterPluginModule{
+	Name: "install",
+	create: func(ctx *PluginModuleContext) (*batchv1.Job, error) {
+		if !ctx.ClusterPluginObj.GetDeletionTimestamp().IsZero() {
+			return nil, nil
+		}
+		spec := ctx.ClusterPluginObj.GetSpec().Install
+		hash := hashPluginSpec(spec)
+		status := ctx.ClusterPluginObj.GetStatus()
+		retried, err := retryFailedMembers(ctx, &status, hash)
+		if err != nil {
+			return nil, err
+		}
+		ctx.ClusterPluginObj.UpdateStatus(status)
+		if retried {
+			return nil, nil
+		}
+		rollout := newRolloutState(ctx, hash)
+		for _, i := range rollout.order(status.Clusters) {
+			member := &status.Clusters[i]
+			cluster := clusterByName(ctx.Clusters, member.Name)
+			//未就绪的集群保持pending,集群就绪后由watch触发
+			if member.Removing || !clusterReady(cluster, ctx.ClusterPluginObj.GetSpec().ClusterReadiness) {
+				continue
+			}
+			//已运行的job继续同步状态,新的install受rolloutStrategy限制
+			last := member.InstallStatus
+			if last.JobName != memberJobName(ctx, member, hash) && (last.JobName == "" || jobFinished(last.Status)) {
+				if !rollout.canStart(member.Name) {
+					continue
+				}
+				rollout.start()
+			}
+			j, err := installMember(ctx, member, cluster, hash)
+			if err != nil {
+				ctx.Info("install cluster error", "cluster", member.Name, "error", err)
+				member.Error = err.Error()
+				continue
+			}
+			if j != nil && j.Name != member.InstallStatus.JobName {
+				member.InstallStatus = clusterv1.ClusterPluginPodStatus{}
+			}
+			setJobStatus(&member.InstallStatus, j)
+			if err := setMemberRun(ctx, member, &member.InstallStatus); err != nil {
+				return nil, err
+			}
+		}
+		ctx.ClusterPluginObj.UpdateStatus(status)
+		return nil, nil
+	},
+	next: func(ctx *PluginModuleContext, j *batchv1.Job) bool {
+		return !ctx.ClusterPluginObj.GetDeletionTimestamp().IsZero()
+	},
+	updateClusterPlugin: func(ctx *PluginModuleContext, j *batchv1.Job) {
+		status := ctx.ClusterPluginObj.GetStatus()
+		hash := hashPluginSpec(ctx.ClusterPluginObj.GetSpec().Install)
+		summary := &clusterv1.ClusterPluginRunSummary{}
+		for _, member := range status.Clusters {
+			if member.Removing {
+				continue
+			}
+			summary.Total++
+			switch {
+			case member.InstallStatus.Status == v13.PodSucceeded && member.InstallStatus.SpecHash == hash:
+				summary.Installed++
+			case member.InstallStatus.Status == v13.PodFailed && member.InstallStatus.SpecHash == hash:
+				summary.Failed++
+			default:
+				summary.Pending++
+			}
+		}
+		status.Summary = summary
+		updateRolloutStatus(ctx, &status, newRolloutState(ctx, hash))
+		if summary.Total > 0 && summary.Installed == summary.Total {
+			status.ObservedGeneration = ctx.ClusterPluginObj.GetGeneration()
+		}
+		ctx.ClusterPluginObj.UpdateStatus(status)
+		if ctx.ClusterPluginObj.GetDeletionTimestamp().IsZero() {
+			controllerutil.AddFinalizer(ctx.ClusterPluginObj, ClusterPluginFinalizerName)
+		}
+	},
+}
+
+var fanOutUninstall = &ClusterPluginModule{
+	Name: "uninstall",
+	create: func(ctx *PluginModuleContext) (*batchv1.Job, error) {
+		spec := ctx.ClusterPluginObj.GetSpec().Uninstall
+		if ctx.ClusterPluginObj.GetDeletionTimestamp().IsZero() || spec.IsEmpty() {
+			return nil, nil
+		}
+		status := ctx.ClusterPluginObj.GetStatus()
+		for i := range status.Clusters {
+			member := &status.Clusters[i]
+			cluster := clusterByName(ctx.Clusters, member.Name)
+			//不再匹配的集群由uninstallRemovedClusters处理,已删除,未初始化或从未install的集群跳过
+			if member.Removing || !clusterInitialized(cluster) || member.InstallStatus.JobName == "" {
+				continue
+			}
+			sub := *ctx
+			sub.Clusters = []*clusterv1.Cluster{cluster}
+			name := getJobName(ctx.ClusterPluginObj, "uninstall-"+member.Name)
+			j, err := getOrCreateJob(&sub, name, spec, hashPluginSpec(spec), member.UninstallStatus)
+			if err != nil {
+				ctx.Info("uninstall cluster error", "cluster", member.Name, "error", err)
+				member.Error = err.Error()
+				continue
+			}
+			setJobStatus(&member.UninstallStatus, j)
+			if err := setMemberRun(ctx, member, &member.UninstallStatus); err != nil {
+				return nil, err
+			}
+		}
+		ctx.ClusterPluginObj.UpdateStatus(status)
+		return nil, nil
+	},
+	next: func(ctx *PluginModuleContext, j *batchv1.Job) bool {
+		if ctx.ClusterPluginObj.GetDeletionTimestamp().IsZero() {
+			return false
+		}
+		if ctx.ClusterPluginObj.GetSpec().Uninstall.IsEmpty() {
+			return true
+		}
+		for _, member := range ctx.ClusterPluginObj.GetStatus().Clusters {
+			if member.Removing || !clusterInitialized(clusterByName(ctx.Clusters, member.Name)) || member.InstallStatus.JobName == "" {
+				continue
+			}
+			if member.UninstallStatus.JobName == "" || !jobFinished(member.UninstallStatus.Status) {
+				return false
+			}
+		}
+		return true
+	},
+	updateClusterPlugin: func(ctx *PluginModuleContext, j *batchv1.Job) {},
+}
+
+// installMember 获取或创建集群当前spec的install job,上一次install未结束时继续等待
+func installMember(ctx *PluginModuleContext, member *clusterv1.ClusterPluginClusterStatus, cluster *clusterv1.Cluster, hash string) (*batchv1.Job, error) {
+	last := member.InstallStatus
+	name := memberJobName(ctx, member, hash)
+	if last.JobName != "" && last.JobName != name && !jobFinished(last.Status) {
+		j, err := getJob(ctx, last.JobName)
+		if err != nil || j != nil {
+			return j, err
+		}
+	}
+	sub := *ctx
+	sub.Clusters = []*clusterv1.Cluster{cluster}
+	return getOrCreateJob(&sub, name, ctx.ClusterPluginObj.GetSpec().Install, hash, last)
+}
+
+func memberJobName(ctx *PluginModuleContext, member *clusterv1.ClusterPluginClusterStatus, hash string) string {
+	return getJobName(ctx.ClusterPluginObj, fmt.Sprintf("install-%s-%s", member.Name, hash[:8]))
+}
+
+// setMemberRun 记录集群最近一次运行的pod及失败原因
+func setMemberRun(ctx *PluginModuleContext, member *clusterv1.ClusterPluginClusterStatus, run *clusterv1.ClusterPluginPodStatus) error {
+	member.Error = ""
+	if run.Status == v13.PodFailed {
+		member.Error = fmt.Sprintf("%s: %s", run.LastFailureReason, run.LastFailureMessage)
+	}
+	if run.JobName == "" {
+		return nil
+	}
+	pods := &v13.PodList{}
+	if err := ctx.List(ctx, pods, client.InNamespace(ctx.ClusterPluginObj.GetNamespace()), client.MatchingLabels{"job-name": run.JobName}); err != nil {
+		return err
+	}
+	//job重试时取最后创建的pod,pod已被清理时保留原值
+	var latest *v13.Pod
+	for i := range pods.Items {
+		if pod := &pods.Items[i]; latest == nil || latest.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			latest = pod
+		}
+	}
+	if latest != nil {
+		member.PodName = latest.Name
+	}
+	return nil
+}
+
+func clusterByName(clusters []*clusterv1.Cluster, name string) *clusterv1.Cluster {
+	for _, c := range clusters {
+		if c != nil && c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func perCluster(obj clusterv1.ClusterPluginObj) bool {
+	cp, ok := obj.(*clusterv1.MultiClusterPlugin)
+	return ok && cp.Spec.ExecutionMode == clusterv1.ExecutionModePerCluster
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	clusterv1 "github.com/kok-stack/kok/api/v1"
+	v13 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestFanOutInstallSummary(t *testing.T) {
+	install := clusterv1.ClusterPluginPodSpec{Containers: []clusterv1.ClusterPluginPodContainer{{Name: "install", Image: "plugin:v1"}}}
+	hash := hashPluginSpec(install)
+	run := func(status v13.PodPhase, specHash string) clusterv1.ClusterPluginPodStatus {
+		return clusterv1.ClusterPluginPodStatus{JobName: "job", Status: status, SpecHash: specHash}
+	}
+	tests := []struct {
+		name     string
+		members  []clusterv1.ClusterPluginClusterStatus
+		want     clusterv1.ClusterPluginRunSummary
+		observed bool
+	}{
+		{
+			name: "all installed",
+			members: []clusterv1.ClusterPluginClusterStatus{
+				{Name: "a", InstallStatus: run(v13.PodSucceeded, hash)},
+				{Name: "b", InstallStatus: run(v13.PodSucceeded, hash)},
+			},
+			want:     clusterv1.ClusterPluginRunSummary{Total: 2, Installed: 2},
+			observed: true,
+		},
+		{
+			name: "mixed",
+			members: []clusterv1.ClusterPluginClusterStatus{
+				{Name: "a", InstallStatus: run(v13.PodSucceeded, hash)},
+				{Name: "b", InstallStatus: run(v13.PodFailed, hash)},
+				{Name: "c", InstallStatus: run(v13.PodRunning, hash)},
+				{Name: "d"},
+			},
+			want: clusterv1.ClusterPluginRunSummary{Total: 4, Installed: 1, Failed: 1, Pending: 2},
+		},
+		{
+			//旧spec的结果不计入当前revision
+			name: "outdated spec",
+			members: []clusterv1.ClusterPluginClusterStatus{
+				{Name: "a", InstallStatus: run(v13.PodSucceeded, "other")},
+				{Name: "b", InstallStatus: run(v13.PodFailed, "other")},
+			},
+			want: clusterv1.ClusterPluginRunSummary{Total: 2, Pending: 2},
+		},
+		{
+			name: "removing clusters not counted",
+			members: []clusterv1.ClusterPluginClusterStatus{
+				{Name: "a", InstallStatus: run(v13.PodSucceeded, hash)},
+				{Name: "b", InstallStatus: run(v13.PodFailed, hash), Removing: true},
+			},
+			want:     clusterv1.ClusterPluginRunSummary{Total: 1, Installed: 1},
+			observed: true,
+		},
+		{
+			name: "no clusters",
+			want: clusterv1.ClusterPluginRunSummary{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cp := &clusterv1.MultiClusterPlugin{ObjectMeta: metav1.ObjectMeta{Name: "m", Namespace: "test", Generation: 2}}
+			cp.Spec.ExecutionMode = clusterv1.ExecutionModePerCluster
+			cp.Spec.Install = install
+			cp.Status.Clusters = tt.members
+			ctx := &PluginModuleContext{
+				EventRecorder:    record.NewFakeRecorder(10),
+				Context:          context.Background(),
+				ClusterPluginObj: cp,
+			}
+			fanOutInstall.updateClusterPlugin(ctx, nil)
+			if cp.Status.Summary == nil || !reflect.DeepEqual(*cp.Status.Summary, tt.want) {
+				t.Errorf("summary = %+v, want %+v", cp.Status.Summary, tt.want)
+			}
+			if observed := cp.Status.ObservedGeneration == 2; observed != tt.observed {
+				t.Errorf("observedGeneration = %d, want observed %v", cp.Status.ObservedGeneration, tt.observed)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"fmt"
+	clusterv1 "github.com/kok-stack/kok/api/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v13 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+)
+
+const (
+	rolloutPromoteAnnotation = "kok.tanx/rollout-promote"
+	//值变化时删除当前revision失败的install job并重新install,处理过的值记录在status.rollout.lastHandledRetry
+	rolloutRetryAnnotation = "kok.tanx/rollout-retry"
+)
+
+var defaultRolloutMaxFailures int32 = 1
+
+// rolloutState PerCluster模式下当前revision的发布进度,未设置rolloutStrategy时不限制
+type rolloutState struct {
+	strategy *clusterv1.RolloutStrategy
+	revision string
+	active   int32
+	failed   []string
+	canary   []string
+	//canary集群均已成功
+	canaryDone bool
+	promoted   bool
+	installed  int32
+	total      int32
+}
+
+func newRolloutState(ctx *PluginModuleContext, hash string) *rolloutState {
+	s := &rolloutState{revision: hash[:8], canaryDone: true}
+	if cp, ok := ctx.ClusterPluginObj.(*clusterv1.MultiClusterPlugin); ok {
+		s.strategy = cp.Spec.RolloutStrategy
+	}
+	s.promoted = ctx.ClusterPluginObj.GetAnnotations()[rolloutPromoteAnnotation] == s.revision
+	for _, member := range ctx.ClusterPluginObj.GetStatus().Clusters {
+		if member.Removing {
+			continue
+		}
+		s.total++
+		run := member.InstallStatus
+		if run.JobName != "" && !jobFinished(run.Status) {
+			s.active++
+		}
+		succeeded := run.SpecHash == hash && run.Status == v13.PodSucceeded
+		if succeeded {
+			s.installed++
+		}
+		if run.SpecHash == hash && run.Status == v13.PodFailed {
+			s.failed = append(s.failed, member.Name)
+		}
+		if s.isCanary(member.Name) {
+			s.canary = append(s.canary, member.Name)
+			s.canaryDone = s.canaryDone && succeeded
+		}
+	}
+	return s
+}
+
+func (s *rolloutState) isCanary(name string) bool {
+	return s.strategy != nil && containsString(s.strategy.Canary, name)
+}
+
+// order 返回install的顺序,canary集群优先
+func (s *rolloutState) order(members []clusterv1.ClusterPluginClusterStatus) []int {
+	var canary, rest []int
+	for i, member := range members {
+		if s.isCanary(member.Name) {
+			canary = append(canary, i)
+		} else {
+			rest = append(rest, i)
+		}
+	}
+	return append(canary, rest...)
+}
+
+// canStart 是否可以在集群上开始新的install
+func (s *rolloutState) canStart(name string) bool {
+	if s.strategy == nil {
+		return true
+	}
+	phase, _ := s.phase()
+	if phase == clusterv1.RolloutPhasePaused {
+		return false
+	}
+	if s.strategy.MaxConcurrent != nil && s.active >= *s.strategy.MaxConcurrent {
+		return false
+	}
+	if s.isCanary(name) {
+		return true
+	}
+	return s.canaryDone && (!s.strategy.ManualPromotion || s.promoted)
+}
+
+func (s *rolloutState) start() {
+	s.active++
+}
+
+func (s *rolloutState) phase() (clusterv1.RolloutPhase, string) {
+	maxFailures := defaultRolloutMaxFailures
+	if s.strategy.MaxFailures != nil {
+		maxFailures = *s.strategy.MaxFailures
+	}
+	switch {
+	case int32(len(s.failed)) >= maxFailures:
+		return clusterv1.RolloutPhasePaused, fmt.Sprintf("install failed on %s, change annotation %s to retry", strings.Join(s.failed, ","), rolloutRetryAnnotation)
+	case s.total > 0 && s.installed == s.total:
+		return clusterv1.RolloutPhaseCompleted, ""
+	case !s.canaryDone:
+		return clusterv1.RolloutPhaseCanary, strings.Join(s.canary, ",")
+	case s.strategy.ManualPromotion && !s.promoted:
+		return clusterv1.RolloutPhaseWaitingForPromotion, fmt.Sprintf("annotate %s=%s to continue", rolloutPromoteAnnotation, s.revision)
+	}
+	return clusterv1.RolloutPhaseProgressing, fmt.Sprintf("%d/%d clusters installed", s.installed, s.total)
+}
+
+// updateRolloutStatus 更新status.rollout,阶段变化时记录事件
+func updateRolloutStatus(ctx *PluginModuleContext, status *clusterv1.ClusterPluginStatus, s *rolloutState) {
+	if s.strategy == nil {
+		status.Rollout = nil
+		return
+	}
+	phase, message := s.phase()
+	var lastRetry string
+	if status.Rollout != nil {
+		lastRetry = status.Rollout.LastHandledRetry
+	}
+	if status.Rollout == nil || status.Rollout.Revision != s.revision || status.Rollout.Phase != phase {
+		eventType := v13.EventTypeNormal
+		if phase == clusterv1.RolloutPhasePaused {
+			eventType = v13.EventTypeWarning
+		}
+		ctx.Event(ctx.ClusterPluginObj, eventType, "Rollout"+string(phase), fmt.Sprintf("revision %s: %s", s.revision, message))
+	}
+	status.Rollout = &clusterv1.RolloutStatus{
+		Revision:         s.revision,
+		Phase:            phase,
+		Message:          message,
+		LastHandledRetry: lastRetry,
+	}
+}
+
+// retryFailedMembers annotation kok.tanx/rollout-retry变化时删除当前revision失败的install job,
+// 清除集群的install记录,返回是否有需要重试的集群.job删除后由watch触发调谐,按rolloutStrategy重新install
+func retryFailedMembers(ctx *PluginModuleContext, status *clusterv1.ClusterPluginStatus, hash string) (bool, error) {
+	retry := ctx.ClusterPluginObj.GetAnnotations()[rolloutRetryAnnotation]
+	if retry == "" || status.Rollout == nil || status.Rollout.LastHandledRetry == retry {
+		return false, nil
+	}
+	retried := false
+	policy := metav1.DeletePropagationBackground
+	for i := range status.Clusters {
+		member := &status.Clusters[i]
+		run := member.InstallStatus
+		if run.SpecHash != hash || run.Status != v13.PodFailed {
+			continue
+		}
+		ctx.Event(ctx.ClusterPluginObj, v13.EventTypeNormal, "RolloutRetry", fmt.Sprintf("retry install on cluster %s", member.Name))
+		err := ctx.Client.Delete(ctx, &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      run.JobName,
+				Namespace: ctx.ClusterPluginObj.GetNamespace(),
+			},
+		}, &client.DeleteOptions{PropagationPolicy: &policy})
+		if client.IgnoreNotFound(err) != nil {
+			return false, err
+		}
+		member.InstallStatus = clusterv1.ClusterPluginPodStatus{}
+		member.Error = ""
+		retried = true
+	}
+	status.Rollout.LastHandledRetry = retry
+	return retried, nil
+}
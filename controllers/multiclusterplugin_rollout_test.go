@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	clusterv1 "github.com/kok-stack/kok/api/v1"
+	"k8s.io/api/admission/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	v13 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestRetryFailedMembers(t *testing.T) {
+	hash := "0123456789abcdef"
+	cp := &clusterv1.MultiClusterPlugin{ObjectMeta: metav1.ObjectMeta{
+		Name:        "m",
+		Namespace:   "test",
+		Annotations: map[string]string{rolloutRetryAnnotation: "1"},
+	}}
+	failedJob := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "failed", Namespace: "test"}}
+	cli := fake.NewFakeClientWithScheme(testScheme(t), cp, failedJob)
+	ctx := &PluginModuleContext{
+		Client:           cli,
+		EventRecorder:    record.NewFakeRecorder(10),
+		Context:          context.Background(),
+		ClusterPluginObj: cp,
+	}
+	status := clusterv1.ClusterPluginStatus{
+		Rollout: &clusterv1.RolloutStatus{Revision: hash[:8], Phase: clusterv1.RolloutPhasePaused},
+		Clusters: []clusterv1.ClusterPluginClusterStatus{
+			{Name: "a", InstallStatus: clusterv1.ClusterPluginPodStatus{JobName: "failed", SpecHash: hash, Status: v13.PodFailed}, Error: "boom"},
+			{Name: "b", InstallStatus: clusterv1.ClusterPluginPodStatus{JobName: "old", SpecHash: "other", Status: v13.PodFailed}},
+			{Name: "c", InstallStatus: clusterv1.ClusterPluginPodStatus{JobName: "ok", SpecHash: hash, Status: v13.PodSucceeded}},
+		},
+	}
+
+	retried, err := retryFailedMembers(ctx, &status, hash)
+	if err != nil || !retried {
+		t.Fatalf("retryFailedMembers() = %v, %v", retried, err)
+	}
+	if status.Clusters[0].InstallStatus.JobName != "" || status.Clusters[0].Error != "" {
+		t.Errorf("failed member not reset: %+v", status.Clusters[0])
+	}
+	if status.Clusters[1].InstallStatus.JobName != "old" || status.Clusters[2].InstallStatus.JobName != "ok" {
+		t.Errorf("other members changed: %+v", status.Clusters)
+	}
+	if err := cli.Get(context.Background(), client.ObjectKey{Namespace: "test", Name: "failed"}, &batchv1.Job{}); err == nil {
+		t.Error("failed job not deleted")
+	}
+	if status.Rollout.LastHandledRetry != "1" {
+		t.Errorf("lastHandledRetry = %s", status.Rollout.LastHandledRetry)
+	}
+
+	//同一个值只处理一次
+	if retried, _ := retryFailedMembers(ctx, &status, hash); retried {
+		t.Error("retry handled twice")
+	}
+}
+
+func TestMultiClusterPluginValidator(t *testing.T) {
+	decoder, err := admission.NewDecoder(testScheme(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &MultiClusterPluginValidator{}
+	if err := v.InjectDecoder(decoder); err != nil {
+		t.Fatal(err)
+	}
+	plugin := func(mode clusterv1.ExecutionMode, strategy *clusterv1.RolloutStrategy) runtime.RawExtension {
+		data, _ := json.Marshal(&clusterv1.MultiClusterPlugin{
+			TypeMeta:   metav1.TypeMeta{APIVersion: clusterv1.GroupVersion.String(), Kind: multiClusterPluginKind},
+			ObjectMeta: metav1.ObjectMeta{Name: "m", Namespace: "test"},
+			Spec:       clusterv1.MultiClusterPluginSpec{ExecutionMode: mode, RolloutStrategy: strategy},
+		})
+		return runtime.RawExtension{Raw: data}
+	}
+	strategy := &clusterv1.RolloutStrategy{Canary: []string{"a"}}
+	tests := []struct {
+		name    string
+		op      v1beta1.Operation
+		object  runtime.RawExtension
+		old     runtime.RawExtension
+		allowed bool
+	}{
+		{name: "per cluster rollout", op: v1beta1.Create, object: plugin(clusterv1.ExecutionModePerCluster, strategy), allowed: true},
+		{name: "single without rollout", op: v1beta1.Create, object: plugin(clusterv1.ExecutionModeSingle, nil), allowed: true},
+		{name: "single rollout", op: v1beta1.Create, object: plugin(clusterv1.ExecutionModeSingle, strategy)},
+		{name: "default mode rollout", op: v1beta1.Create, object: plugin("", strategy)},
+		{name: "switch to single", op: v1beta1.Update, object: plugin(clusterv1.ExecutionModeSingle, strategy), old: plugin(clusterv1.ExecutionModePerCluster, strategy)},
+		{name: "unchanged existing", op: v1beta1.Update, object: plugin("", strategy), old: plugin("", strategy), allowed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := v.Handle(context.Background(), admission.Request{AdmissionRequest: v1beta1.AdmissionRequest{
+				Operation: tt.op,
+				Object:    tt.object,
+				OldObject: tt.old,
+			}})
+			if resp.Allowed != tt.allowed {
+				t.Errorf("allowed = %v, want %v: %v", resp.Allowed, tt.allowed, resp.Result)
+			}
+		})
+	}
+}
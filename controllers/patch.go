@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"context"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type patchObject interface {
+	runtime.Object
+	metav1.Object
+}
+
+// PatchStatusAndFinalizers 先通过merge patch写入finalizers,再通过status子资源merge patch写入status,
+// 不再整体Update对象,避免与webhook默认值及并发修改冲突.orig为调谐开始时对象的拷贝
+func PatchStatusAndFinalizers(ctx context.Context, cli client.Client, obj, orig patchObject) error {
+	finalizers := obj.GetFinalizers()
+	if !equalStrings(finalizers, orig.GetFinalizers()) {
+		current, err := patchFinalizers(ctx, cli, obj, orig)
+		if err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		//finalizers清空后对象可能已被删除,无需再写status
+		if len(current.GetFinalizers()) == 0 && !current.GetDeletionTimestamp().IsZero() {
+			return nil
+		}
+	}
+
+	base := orig.DeepCopyObject().(patchObject)
+	base.SetFinalizers(finalizers)
+	patch := client.MergeFrom(base)
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	if string(data) == "{}" {
+		return nil
+	}
+	return client.IgnoreNotFound(cli.Status().Patch(ctx, obj, patch))
+}
+
+// patchFinalizers finalizers是列表,merge patch会整体覆盖,patch中带上resourceVersion避免覆盖其他控制器的修改.
+// 冲突时重新读取对象,只应用本次调谐新增及移除的finalizer
+func patchFinalizers(ctx context.Context, cli client.Client, obj, orig patchObject) (patchObject, error) {
+	current := orig.DeepCopyObject().(patchObject)
+	first := true
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !first {
+			current = orig.DeepCopyObject().(patchObject)
+			if err := cli.Get(ctx, client.ObjectKey{Namespace: orig.GetNamespace(), Name: orig.GetName()}, current); err != nil {
+				return err
+			}
+		}
+		first = false
+		want := mergeFinalizers(current.GetFinalizers(), orig.GetFinalizers(), obj.GetFinalizers())
+		if equalStrings(want, current.GetFinalizers()) {
+			return nil
+		}
+		//base不含resourceVersion,patch中总会带上当前的resourceVersion,apiserver据此检查冲突
+		base := current.DeepCopyObject().(patchObject)
+		base.SetResourceVersion("")
+		meta := current.DeepCopyObject().(patchObject)
+		meta.SetFinalizers(want)
+		if err := cli.Patch(ctx, meta, client.MergeFrom(base)); err != nil {
+			return err
+		}
+		current = meta
+		return nil
+	})
+	return current, err
+}
+
+// mergeFinalizers 在current上应用desired相对orig的变化
+func mergeFinalizers(current, orig, desired []string) []string {
+	out := make([]string, 0, len(current))
+	for _, f := range current {
+		if containsString(orig, f) && !containsString(desired, f) {
+			continue
+		}
+		out = append(out, f)
+	}
+	for _, f := range desired {
+		if !containsString(orig, f) && !containsString(out, f) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(s []string, v string) bool {
+	for _, item := range s {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	clusterv1 "github.com/kok-stack/kok/api/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// conflictClient 前conflicts次Patch返回冲突,模拟对象已被其他控制器修改
+type conflictClient struct {
+	client.Client
+	conflicts int
+	patches   int
+}
+
+func (c *conflictClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	c.patches++
+	if c.conflicts > 0 {
+		c.conflicts--
+		return errors.NewConflict(schema.GroupResource{Resource: "clusterplugins"}, "a", nil)
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestPatchStatusAndFinalizers(t *testing.T) {
+	tests := []struct {
+		name      string
+		stored    []string
+		orig      []string
+		desired   []string
+		conflicts int
+		want      []string
+	}{
+		{
+			name:    "add finalizer",
+			desired: []string{ClusterPluginFinalizerName},
+			want:    []string{ClusterPluginFinalizerName},
+		},
+		{
+			name:   "remove finalizer",
+			stored: []string{ClusterPluginFinalizerName},
+			orig:   []string{ClusterPluginFinalizerName},
+			want:   []string{},
+		},
+		{
+			name:      "keep finalizer added concurrently",
+			stored:    []string{"other"},
+			desired:   []string{ClusterPluginFinalizerName},
+			conflicts: 1,
+			want:      []string{"other", ClusterPluginFinalizerName},
+		},
+		{
+			name:      "remove finalizer after concurrent change",
+			stored:    []string{ClusterPluginFinalizerName, "other"},
+			orig:      []string{ClusterPluginFinalizerName},
+			conflicts: 1,
+			want:      []string{"other"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := testPlugin("a")
+			stored.Finalizers = tt.stored
+			cli := &conflictClient{Client: fake.NewFakeClientWithScheme(testScheme(t), stored), conflicts: tt.conflicts}
+
+			orig := testPlugin("a")
+			if err := cli.Get(context.Background(), client.ObjectKey{Namespace: "test", Name: "a"}, orig); err != nil {
+				t.Fatal(err)
+			}
+			orig.Finalizers = tt.orig
+			obj := orig.DeepCopy()
+			obj.Finalizers = tt.desired
+			if err := PatchStatusAndFinalizers(context.Background(), cli, obj, orig); err != nil {
+				t.Fatal(err)
+			}
+			if cli.patches != tt.conflicts+1 {
+				t.Errorf("patches = %d, want %d", cli.patches, tt.conflicts+1)
+			}
+
+			got := &clusterv1.ClusterPlugin{}
+			if err := cli.Get(context.Background(), client.ObjectKey{Namespace: "test", Name: "a"}, got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Finalizers) != 0 || len(tt.want) != 0 {
+				if !reflect.DeepEqual(got.Finalizers, tt.want) {
+					t.Errorf("finalizers = %v, want %v", got.Finalizers, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeFinalizers(t *testing.T) {
+	got := mergeFinalizers([]string{"a", "b", "c"}, []string{"a", "b"}, []string{"b", "d"})
+	want := []string{"b", "c", "d"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeFinalizers() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	clusterv1 "github.com/kok-stack/kok/api/v1"
+	v13 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"strings"
+)
+
+const (
+	clusterPluginKind      = "ClusterPlugin"
+	multiClusterPluginKind = "MultiClusterPlugin"
+)
+
+// checkDependencies 检查依赖的插件是否都已install成功,未就绪时返回原因及说明
+func checkDependencies(ctx *PluginModuleContext) (reason, message string, err error) {
+	obj := ctx.ClusterPluginObj
+	cycle, err := dependencyCycle(ctx, ctx.Client, obj)
+	if err != nil {
+		return "", "", err
+	}
+	if len(cycle) > 0 {
+		return "DependencyCycle", strings.Join(cycle, " -> "), nil
+	}
+	var waiting []string
+	for _, ref := range obj.GetSpec().DependsOn {
+		dep, err := getPluginObj(ctx, ctx.Client, obj.GetNamespace(), ref)
+		if errors.IsNotFound(err) {
+			return "DependencyNotFound", refString(ref), nil
+		}
+		if err != nil {
+			return "", "", err
+		}
+		if missing := missingClusters(obj, dep); len(missing) > 0 {
+			return "DependencyClusterMismatch", fmt.Sprintf("%s not target %s", refString(ref), strings.Join(missing, ",")), nil
+		}
+		if !installSucceeded(dep) {
+			waiting = append(waiting, refString(ref))
+		}
+	}
+	if len(waiting) > 0 {
+		return "DependencyNotReady", strings.Join(waiting, ","), nil
+	}
+	return "", "", nil
+}
+
+// uninstallingDependents 返回依赖于本插件且正在删除的插件,本插件需等待它们uninstall完成
+func uninstallingDependents(ctx *PluginModuleContext) ([]string, error) {
+	obj := ctx.ClusterPluginObj
+	//存在循环依赖时互相等待会导致无法删除
+	cycle, err := dependencyCycle(ctx, ctx.Client, obj)
+	if err != nil || len(cycle) > 0 {
+		return nil, err
+	}
+	plugins, err := listPlugins(ctx, ctx.Client, obj.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+	var dependents []string
+	for _, p := range plugins {
+		if !p.GetDeletionTimestamp().IsZero() && dependsOn(p, pluginKind(obj), obj.GetName()) {
+			dependents = append(dependents, pluginKind(p)+"/"+p.GetName())
+		}
+	}
+	return dependents, nil
+}
+
+// dependencyCycle 沿dependsOn查找回到本插件的路径
+func dependencyCycle(ctx context.Context, cli client.Client, obj clusterv1.ClusterPluginObj) ([]string, error) {
+	self := pluginKind(obj) + "/" + obj.GetName()
+	visited := map[string]bool{}
+	var visit func(o clusterv1.ClusterPluginObj, path []string) ([]string, error)
+	visit = func(o clusterv1.ClusterPluginObj, path []string) ([]string, error) {
+		for _, ref := range o.GetSpec().DependsOn {
+			key := refString(ref)
+			if key == self {
+				return append(path, key), nil
+			}
+			if visited[key] {
+				continue
+			}
+			visited[key] = true
+			dep, err := getPluginObj(ctx, cli, obj.GetNamespace(), ref)
+			if errors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if cycle, err := visit(dep, append(path, key)); err != nil || cycle != nil {
+				return cycle, err
+			}
+		}
+		return nil, nil
+	}
+	return visit(obj, []string{self})
+}
+
+// installPending 当前spec尚未install成功且没有正在运行的install
+func installPending(obj clusterv1.ClusterPluginObj) bool {
+	status := obj.GetStatus()
+	return status.ObservedGeneration != obj.GetGeneration() &&
+		(status.InstallStatus.JobName == "" || jobFinished(status.InstallStatus.Status))
+}
+
+func installSucceeded(obj clusterv1.ClusterPluginObj) bool {
+	return obj.GetDeletionTimestamp().IsZero() && obj.GetStatus().ObservedGeneration == obj.GetGeneration()
+}
+
+// missingClusters 返回obj的集群中dep未覆盖的集群
+func missingClusters(obj, dep clusterv1.ClusterPluginObj) []string {
+	clusters := strings.Split(dep.GetClusterNames(), ",")
+	var missing []string
+	for _, name := range strings.Split(obj.GetClusterNames(), ",") {
+		if !containsString(clusters, name) {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+func dependsOn(obj clusterv1.ClusterPluginObj, kind, name string) bool {
+	for _, ref := range obj.GetSpec().DependsOn {
+		if refKind(ref) == kind && ref.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func getPluginObj(ctx context.Context, cli client.Client, namespace string, ref clusterv1.ClusterPluginReference) (clusterv1.ClusterPluginObj, error) {
+	var obj clusterv1.ClusterPluginObj = &clusterv1.ClusterPlugin{}
+	if refKind(ref) == multiClusterPluginKind {
+		obj = &clusterv1.MultiClusterPlugin{}
+	}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func listPlugins(ctx context.Context, cli client.Client, namespace string) ([]clusterv1.ClusterPluginObj, error) {
+	cps := &clusterv1.ClusterPluginList{}
+	if err := cli.List(ctx, cps, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	mcps := &clusterv1.MultiClusterPluginList{}
+	if err := cli.List(ctx, mcps, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	plugins := make([]clusterv1.ClusterPluginObj, 0, len(cps.Items)+len(mcps.Items))
+	for i := range cps.Items {
+		plugins = append(plugins, &cps.Items[i])
+	}
+	for i := range mcps.Items {
+		plugins = append(plugins, &mcps.Items[i])
+	}
+	return plugins, nil
+}
+
+func pluginKind(obj clusterv1.ClusterPluginObj) string {
+	if _, ok := obj.(*clusterv1.MultiClusterPlugin); ok {
+		return multiClusterPluginKind
+	}
+	return clusterPluginKind
+}
+
+func refKind(ref clusterv1.ClusterPluginReference) string {
+	if ref.Kind == "" {
+		return clusterPluginKind
+	}
+	return ref.Kind
+}
+
+func refString(ref clusterv1.ClusterPluginReference) string {
+	return refKind(ref) + "/" + ref.Name
+}
+
+// pluginDependencyRequests 插件变化时触发与其存在依赖关系的kind类型插件调谐
+func pluginDependencyRequests(cli client.Client, kind string) handler.ToRequestsFunc {
+	return func(o handler.MapObject) []ctrl.Request {
+		obj, ok := o.Object.(clusterv1.ClusterPluginObj)
+		if !ok {
+			return nil
+		}
+		var requests []ctrl.Request
+		add := func(name string) {
+			requests = append(requests, ctrl.Request{NamespacedName: types.NamespacedName{
+				Namespace: obj.GetNamespace(),
+				Name:      name,
+			}})
+		}
+		for _, ref := range obj.GetSpec().DependsOn {
+			if refKind(ref) == kind {
+				add(ref.Name)
+			}
+		}
+		plugins, err := listPlugins(context.Background(), cli, obj.GetNamespace())
+		if err != nil {
+			return requests
+		}
+		for _, p := range plugins {
+			if pluginKind(p) == kind && dependsOn(p, pluginKind(obj), obj.GetName()) {
+				add(p.GetName())
+			}
+		}
+		return requests
+	}
+}
+
+// setWaitingForDependencies 设置WaitingForDependencies condition,message为空时表示依赖已就绪
+func setWaitingForDependencies(ctx *PluginModuleContext, reason, message string) {
+	status := ctx.ClusterPluginObj.GetStatus()
+	if message == "" {
+		if clusterv1.GetCondition(status.Conditions, clusterv1.ConditionWaitingForDependencies) == nil {
+			return
+		}
+		clusterv1.SetCondition(&status.Conditions, clusterv1.ConditionWaitingForDependencies, v13.ConditionFalse, "DependenciesReady", "")
+	} else {
+		clusterv1.SetCondition(&status.Conditions, clusterv1.ConditionWaitingForDependencies, v13.ConditionTrue, reason, message)
+	}
+	ctx.ClusterPluginObj.UpdateStatus(status)
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	clusterv1 "github.com/kok-stack/kok/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDependencyCycle(t *testing.T) {
+	multi := &clusterv1.MultiClusterPlugin{
+		ObjectMeta: metav1.ObjectMeta{Name: "m", Namespace: "test"},
+		Spec: clusterv1.MultiClusterPluginSpec{
+			CLusterPluginSpecInner: clusterv1.CLusterPluginSpecInner{DependsOn: []clusterv1.ClusterPluginReference{ref("", "a")}},
+		},
+	}
+	tests := []struct {
+		name    string
+		objs    []runtime.Object
+		subject clusterv1.ClusterPluginObj
+		want    []string
+	}{
+		{
+			name:    "no dependencies",
+			objs:    []runtime.Object{testPlugin("a")},
+			subject: testPlugin("a"),
+		},
+		{
+			name:    "chain without cycle",
+			objs:    []runtime.Object{testPlugin("a", ref("", "b")), testPlugin("b", ref("", "c")), testPlugin("c")},
+			subject: testPlugin("a", ref("", "b")),
+		},
+		{
+			name:    "missing dependency",
+			objs:    []runtime.Object{testPlugin("a", ref("", "b"))},
+			subject: testPlugin("a", ref("", "b")),
+		},
+		{
+			name:    "self dependency",
+			objs:    []runtime.Object{testPlugin("a", ref("", "a"))},
+			subject: testPlugin("a", ref("", "a")),
+			want:    []string{"ClusterPlugin/a", "ClusterPlugin/a"},
+		},
+		{
+			name:    "indirect cycle",
+			objs:    []runtime.Object{testPlugin("a", ref("", "b")), testPlugin("b", ref("", "c")), testPlugin("c", ref("", "a"))},
+			subject: testPlugin("a", ref("", "b")),
+			want:    []string{"ClusterPlugin/a", "ClusterPlugin/b", "ClusterPlugin/c", "ClusterPlugin/a"},
+		},
+		{
+			name:    "cycle across kinds",
+			objs:    []runtime.Object{testPlugin("a", ref(multiClusterPluginKind, "m")), multi},
+			subject: testPlugin("a", ref(multiClusterPluginKind, "m")),
+			want:    []string{"ClusterPlugin/a", "MultiClusterPlugin/m", "ClusterPlugin/a"},
+		},
+		{
+			name:    "cycle not through subject",
+			objs:    []runtime.Object{testPlugin("a", ref("", "b")), testPlugin("b", ref("", "c")), testPlugin("c", ref("", "b"))},
+			subject: testPlugin("a", ref("", "b")),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := fake.NewFakeClientWithScheme(testScheme(t), tt.objs...)
+			got, err := dependencyCycle(context.Background(), cli, tt.subject)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dependencyCycle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	clusterv1 "github.com/kok-stack/kok/api/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+)
+
+// +kubebuilder:rbac:groups=cluster.kok.tanx,resources=clusterplugintemplates,verbs=get;list;watch
+
+// renderPluginTemplate 按updatePolicy将引用的模板渲染到ClusterPlugin的spec,返回spec是否被更新.
+// spec更新后由watch触发下一次调谐,install按新spec的hash重新运行
+func renderPluginTemplate(ctx context.Context, cli client.Client, cp *clusterv1.ClusterPlugin) (bool, error) {
+	ref := cp.Spec.Template
+	tmpl := &clusterv1.ClusterPluginTemplate{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: cp.Namespace, Name: ref.Name}, tmpl); err != nil {
+		return false, err
+	}
+	valuesHash := hashValues(ref.Values)
+	applied := cp.Status.Template
+	if applied.Name == ref.Name && applied.ValuesHash == valuesHash &&
+		(applied.Generation == tmpl.Generation || ref.UpdatePolicy == clusterv1.TemplateUpdatePolicyManual) {
+		if applied.SpecHash == templateSpecHash(cp.Spec.CLusterPluginSpecInner) {
+			return false, nil
+		}
+		//install,uninstall以模板为准,直接修改的内容需要覆盖.Manual时按上次渲染的内容恢复,不引入新版本模板
+		if ref.UpdatePolicy == clusterv1.TemplateUpdatePolicyManual && applied.Rendered != "" {
+			return restoreRenderedSpec(ctx, cli, cp)
+		}
+	}
+	rendered, err := tmpl.Render(ref.Values)
+	if err != nil {
+		return false, fmt.Errorf("render template %s error: %v", ref.Name, err)
+	}
+
+	orig := cp.DeepCopy()
+	mergeTemplateSpec(&cp.Spec.CLusterPluginSpecInner, rendered)
+	patch := client.MergeFrom(orig)
+	data, err := patch.Data(cp)
+	if err != nil {
+		return false, err
+	}
+	updated := string(data) != "{}"
+	if updated {
+		if err := cli.Patch(ctx, cp, patch); err != nil {
+			return false, err
+		}
+	}
+
+	orig = cp.DeepCopy()
+	cp.Status.Template = clusterv1.ClusterPluginTemplateStatus{
+		Name:       ref.Name,
+		Generation: tmpl.Generation,
+		ValuesHash: valuesHash,
+		SpecHash:   templateSpecHash(cp.Spec.CLusterPluginSpecInner),
+		Rendered:   renderedSpec(cp.Spec.CLusterPluginSpecInner),
+	}
+	return updated, cli.Status().Patch(ctx, cp, client.MergeFrom(orig))
+}
+
+// mergeTemplateSpec install,uninstall以模板为准,dependsOn与模板合并,其他字段只在模板中设置时覆盖
+func mergeTemplateSpec(spec *clusterv1.CLusterPluginSpecInner, t clusterv1.CLusterPluginSpecInner) {
+	spec.Install = t.Install
+	spec.Uninstall = t.Uninstall
+	if t.BackoffLimit != nil {
+		spec.BackoffLimit = t.BackoffLimit
+	}
+	if t.ActiveDeadlineSeconds != nil {
+		spec.ActiveDeadlineSeconds = t.ActiveDeadlineSeconds
+	}
+	if t.TTLSecondsAfterFinished != nil {
+		spec.TTLSecondsAfterFinished = t.TTLSecondsAfterFinished
+	}
+	if t.ClusterReadiness != "" {
+		spec.ClusterReadiness = t.ClusterReadiness
+	}
+	spec.DependsOn = mergeDependencies(spec.DependsOn, t.DependsOn)
+}
+
+// mergeDependencies 合并依赖并去重,保持原有顺序
+func mergeDependencies(deps []clusterv1.ClusterPluginReference, more []clusterv1.ClusterPluginReference) []clusterv1.ClusterPluginReference {
+	seen := map[string]bool{}
+	var out []clusterv1.ClusterPluginReference
+	for _, list := range [][]clusterv1.ClusterPluginReference{deps, more} {
+		for _, ref := range list {
+			if seen[refString(ref)] {
+				continue
+			}
+			seen[refString(ref)] = true
+			out = append(out, ref)
+		}
+	}
+	return out
+}
+
+// restoreRenderedSpec 将install,uninstall恢复为status中记录的上次渲染结果
+func restoreRenderedSpec(ctx context.Context, cli client.Client, cp *clusterv1.ClusterPlugin) (bool, error) {
+	var rendered []clusterv1.ClusterPluginPodSpec
+	if err := json.Unmarshal([]byte(cp.Status.Template.Rendered), &rendered); err != nil || len(rendered) != 2 {
+		return false, fmt.Errorf("invalid rendered template in status: %v", err)
+	}
+	orig := cp.DeepCopy()
+	cp.Spec.Install = rendered[0]
+	cp.Spec.Uninstall = rendered[1]
+	return true, cli.Patch(ctx, cp, client.MergeFrom(orig))
+}
+
+// renderedSpec 以模板为准的install,uninstall
+func renderedSpec(spec clusterv1.CLusterPluginSpecInner) string {
+	data, _ := json.Marshal([]clusterv1.ClusterPluginPodSpec{spec.Install, spec.Uninstall})
+	return string(data)
+}
+
+// templateSpecHash 以模板为准的install,uninstall的hash
+func templateSpecHash(spec clusterv1.CLusterPluginSpecInner) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(renderedSpec(spec))))[:16]
+}
+
+func hashValues(values map[string]string) string {
+	//json编码map时key有序
+	data, _ := json.Marshal(values)
+	return fmt.Sprintf("%x", sha256.Sum256(data))[:16]
+}
+
+// templateToPlugins 模板更新时触发引用它的ClusterPlugin调谐
+func (r *ClusterPluginReconciler) templateToPlugins(o handler.MapObject) []ctrl.Request {
+	list := &clusterv1.ClusterPluginList{}
+	if err := r.List(context.Background(), list, client.InNamespace(o.Meta.GetNamespace())); err != nil {
+		r.Log.Info("list ClusterPlugin error", "error", err)
+		return nil
+	}
+	var requests []ctrl.Request
+	for _, item := range list.Items {
+		if item.Spec.Template != nil && item.Spec.Template.Name == o.Meta.GetName() {
+			requests = append(requests, ctrl.Request{NamespacedName: types.NamespacedName{
+				Namespace: item.Namespace,
+				Name:      item.Name,
+			}})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	clusterv1 "github.com/kok-stack/kok/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestMergeTemplateSpec(t *testing.T) {
+	spec := clusterv1.CLusterPluginSpecInner{
+		DependsOn: []clusterv1.ClusterPluginReference{ref("", "a"), ref(clusterPluginKind, "b")},
+	}
+	mergeTemplateSpec(&spec, clusterv1.CLusterPluginSpecInner{
+		DependsOn: []clusterv1.ClusterPluginReference{ref(clusterPluginKind, "a"), ref(multiClusterPluginKind, "m")},
+	})
+	want := []clusterv1.ClusterPluginReference{ref("", "a"), ref(clusterPluginKind, "b"), ref(multiClusterPluginKind, "m")}
+	if !reflect.DeepEqual(spec.DependsOn, want) {
+		t.Errorf("dependsOn = %v, want %v", spec.DependsOn, want)
+	}
+
+	mergeTemplateSpec(&spec, clusterv1.CLusterPluginSpecInner{})
+	if !reflect.DeepEqual(spec.DependsOn, want) {
+		t.Errorf("dependsOn erased by template without dependencies: %v", spec.DependsOn)
+	}
+}
+
+func TestRenderPluginTemplateDirectEdit(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy clusterv1.TemplateUpdatePolicy
+		want   string
+	}{
+		//Auto按最新模板重新渲染
+		{name: "auto", policy: clusterv1.TemplateUpdatePolicyAuto, want: "plugin:v2"},
+		//Manual恢复上次渲染的内容,不引入未确认的模板变化
+		{name: "manual", policy: clusterv1.TemplateUpdatePolicyManual, want: "plugin:v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := &clusterv1.ClusterPluginTemplate{}
+			tmpl.Name, tmpl.Namespace, tmpl.Generation = "tmpl", "test", 1
+			tmpl.Spec.Template.Install.Containers = []clusterv1.ClusterPluginPodContainer{{Name: "install", Image: "plugin:v1"}}
+			cp := testPlugin("p")
+			cp.Spec.Template = &clusterv1.ClusterPluginTemplateRef{Name: "tmpl", UpdatePolicy: tt.policy}
+			cli := fake.NewFakeClientWithScheme(testScheme(t), tmpl, cp)
+			ctx := context.Background()
+			key := client.ObjectKey{Namespace: "test", Name: "p"}
+
+			get := func() *clusterv1.ClusterPlugin {
+				cp := &clusterv1.ClusterPlugin{}
+				if err := cli.Get(ctx, key, cp); err != nil {
+					t.Fatal(err)
+				}
+				return cp
+			}
+			if updated, err := renderPluginTemplate(ctx, cli, get()); err != nil || !updated {
+				t.Fatalf("first render = %v, %v", updated, err)
+			}
+			if updated, err := renderPluginTemplate(ctx, cli, get()); err != nil || updated {
+				t.Fatalf("render without changes = %v, %v", updated, err)
+			}
+
+			//模板更新后直接修改install
+			tmpl.Generation = 2
+			tmpl.Spec.Template.Install.Containers[0].Image = "plugin:v2"
+			if err := cli.Update(ctx, tmpl); err != nil {
+				t.Fatal(err)
+			}
+			edited := get()
+			edited.Spec.Install.Containers[0].Image = "evil"
+			if err := cli.Update(ctx, edited); err != nil {
+				t.Fatal(err)
+			}
+			if updated, err := renderPluginTemplate(ctx, cli, get()); err != nil || !updated {
+				t.Fatalf("render after direct edit = %v, %v", updated, err)
+			}
+			if image := get().Spec.Install.Containers[0].Image; image != tt.want {
+				t.Errorf("install image = %s, want %s", image, tt.want)
+			}
+			if updated, err := renderPluginTemplate(ctx, cli, get()); err != nil || updated {
+				t.Fatalf("render after restore = %v, %v", updated, err)
+			}
+		})
+	}
+}
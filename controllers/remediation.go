@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"fmt"
+	v1 "github.com/kok-stack/kok/api/v1"
+	v12 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
+)
+
+const crashLoopBackOff = "CrashLoopBackOff"
+
+var (
+	defaultCrashLoopRestartThreshold int32 = 5
+	defaultEtcdUnhealthyTimeout            = time.Minute * 5
+	defaultRemediationInterval             = time.Minute * 5
+)
+
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;delete
+
+// Remediate 按spec.remediation修复控制面组件,返回下次需要检查的等待时间
+func Remediate(ctx *ModuleContext) (time.Duration, error) {
+	policy := ctx.Spec.Remediation
+	if policy.Disabled {
+		ctx.Status.Remediation.UnhealthyEtcdMembers = nil
+		return 0, nil
+	}
+	var requeueAfter time.Duration
+	if d, err := restartCrashLoopPods(ctx); err != nil {
+		return 0, err
+	} else if d > 0 {
+		requeueAfter = d
+	}
+	if d, err := replaceEtcdMembers(ctx); err != nil {
+		return 0, err
+	} else if d > 0 && (requeueAfter == 0 || d < requeueAfter) {
+		requeueAfter = d
+	}
+	return requeueAfter, nil
+}
+
+// RemediateJob 失败的job是否允许重新执行,允许时记录修复次数
+func RemediateJob(c *v1.Cluster, name string) bool {
+	if c.Spec.Remediation.Disabled {
+		return false
+	}
+	if wait := remediationWait(c); wait > 0 {
+		return false
+	}
+	recordRemediation(c, fmt.Sprintf("rerun job %s", name), &c.Status.Remediation.JobReruns)
+	return true
+}
+
+func restartCrashLoopPods(ctx *ModuleContext) (time.Duration, error) {
+	threshold := ctx.Spec.Remediation.CrashLoopRestartThreshold
+	if threshold <= 0 {
+		threshold = defaultCrashLoopRestartThreshold
+	}
+	pods := &v12.PodList{}
+	if err := ctx.List(ctx, pods, client.InNamespace(ctx.Namespace), client.MatchingLabels{"cluster": ctx.Name}); err != nil {
+		return 0, err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !crashLooping(pod, threshold) {
+			continue
+		}
+		if wait := remediationWait(ctx.Cluster); wait > 0 {
+			return wait, nil
+		}
+		if err := ctx.Delete(ctx, pod); client.IgnoreNotFound(err) != nil {
+			return 0, err
+		}
+		action := fmt.Sprintf("restart crash looping pod %s", pod.Name)
+		recordRemediation(ctx.Cluster, action, &ctx.Status.Remediation.PodRestarts)
+		ctx.Recorder.Event(ctx, v12.EventTypeWarning, "Remediation", action)
+	}
+	return 0, nil
+}
+
+func crashLooping(pod *v12.Pod, threshold int32) bool {
+	for _, s := range pod.Status.ContainerStatuses {
+		if s.State.Waiting != nil && s.State.Waiting.Reason == crashLoopBackOff && s.RestartCount >= threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// etcd-operator中成员名与pod名相同,删除长期不健康的成员pod后由operator替换该成员
+func replaceEtcdMembers(ctx *ModuleContext) (time.Duration, error) {
+	status := &ctx.Status.Remediation
+	timeout := defaultEtcdUnhealthyTimeout
+	if t := ctx.Spec.Remediation.EtcdUnhealthyTimeout; t != nil {
+		timeout = t.Duration
+	}
+	now := metav1.Now()
+	var unhealthy []v1.ClusterUnhealthyMember
+	for _, name := range ctx.Status.Etcd.Status.Members.Unready {
+		member := v1.ClusterUnhealthyMember{Name: name, Since: now}
+		for _, m := range status.UnhealthyEtcdMembers {
+			if m.Name == name {
+				member.Since = m.Since
+			}
+		}
+		unhealthy = append(unhealthy, member)
+	}
+	status.UnhealthyEtcdMembers = unhealthy
+
+	var requeueAfter time.Duration
+	for _, member := range unhealthy {
+		d := timeout - now.Sub(member.Since.Time)
+		if d <= 0 {
+			d = remediationWait(ctx.Cluster)
+		}
+		if d > 0 {
+			if requeueAfter == 0 || d < requeueAfter {
+				requeueAfter = d
+			}
+			continue
+		}
+		pod := &v12.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: ctx.Namespace, Name: member.Name}}
+		if err := ctx.Delete(ctx, pod); client.IgnoreNotFound(err) != nil {
+			return 0, err
+		}
+		action := fmt.Sprintf("replace unhealthy etcd member %s", member.Name)
+		recordRemediation(ctx.Cluster, action, &status.EtcdMemberReplacements)
+		ctx.Recorder.Event(ctx, v12.EventTypeWarning, "Remediation", action)
+	}
+	return requeueAfter, nil
+}
+
+// remediationWait 距离允许下一次修复还需等待的时间,避免修复操作来回抖动
+func remediationWait(c *v1.Cluster) time.Duration {
+	last := c.Status.Remediation.LastRemediationTime
+	if last == nil {
+		return 0
+	}
+	interval := defaultRemediationInterval
+	if i := c.Spec.Remediation.MinInterval; i != nil {
+		interval = i.Duration
+	}
+	return interval - time.Since(last.Time)
+}
+
+// FailedJobRequeue 失败job因限流暂未重跑时,返回下次检查的等待时间
+func FailedJobRequeue(c *v1.Cluster, failed bool) time.Duration {
+	if !failed || c.Spec.Remediation.Disabled {
+		return 0
+	}
+	if wait := remediationWait(c); wait > time.Second {
+		return wait
+	}
+	return time.Second
+}
+
+func recordRemediation(c *v1.Cluster, action string, counter *int32) {
+	now := metav1.Now()
+	*counter++
+	c.Status.Remediation.LastAction = action
+	c.Status.Remediation.LastRemediationTime = &now
+}
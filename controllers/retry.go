@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	v1 "github.com/kok-stack/kok/api/v1"
+	v12 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"time"
+)
+
+var (
+	defaultRetryMaxAttempts int32 = 10
+	defaultRetryBaseDelay         = time.Second
+	defaultRetryMaxDelay          = time.Minute * 5
+	retryJitter                   = 0.2
+)
+
+// ModuleBackoff 返回模块距离下次重试还需等待的时间,模块已达到最大重试次数时failed为true.
+// spec变化后(generation不同)清除该模块的重试记录
+func ModuleBackoff(c *v1.Cluster, module string) (d time.Duration, failed bool) {
+	r := getModuleRetry(c, module)
+	if r == nil {
+		return 0, false
+	}
+	if r.ObservedGeneration != c.Generation {
+		ClearModuleRetry(c, module)
+		return 0, false
+	}
+	if r.NextRetryTime == nil {
+		return 0, true
+	}
+	return time.Until(r.NextRetryTime.Time), false
+}
+
+// RecordModuleFailure 记录模块失败,返回按指数退避(带抖动)计算的重试等待时间,
+// 达到最大重试次数时设置Failed condition并返回0
+func RecordModuleFailure(c *v1.Cluster, module string, err error) time.Duration {
+	maxAttempts, base, max := retryPolicy(c)
+	r := getModuleRetry(c, module)
+	if r == nil {
+		c.Status.Retries = append(c.Status.Retries, v1.ClusterModuleRetryStatus{Module: module})
+		r = &c.Status.Retries[len(c.Status.Retries)-1]
+	}
+	now := metav1.Now()
+	r.Attempts++
+	r.ObservedGeneration = c.Generation
+	r.LastError = err.Error()
+	r.LastFailureTime = &now
+	r.NextRetryTime = nil
+	if r.Attempts >= maxAttempts {
+		v1.SetCondition(&c.Status.Conditions, v1.ConditionFailed, v12.ConditionTrue, "MaxAttemptsExceeded", module+": "+r.LastError)
+		return 0
+	}
+
+	d := base
+	for i := int32(1); i < r.Attempts && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	d = wait.Jitter(d, retryJitter)
+	next := metav1.NewTime(now.Add(d))
+	r.NextRetryTime = &next
+	return d
+}
+
+// ClearModuleRetry 模块调谐成功后清除重试记录,全部清除后解除Failed状态
+func ClearModuleRetry(c *v1.Cluster, module string) {
+	retries := c.Status.Retries[:0]
+	for _, r := range c.Status.Retries {
+		if r.Module != module {
+			retries = append(retries, r)
+		}
+	}
+	if len(retries) == 0 {
+		retries = nil
+		if v1.GetCondition(c.Status.Conditions, v1.ConditionFailed) != nil {
+			v1.SetCondition(&c.Status.Conditions, v1.ConditionFailed, v12.ConditionFalse, "Reconciled", "")
+		}
+	}
+	c.Status.Retries = retries
+}
+
+// ResetModuleRetries 清除所有模块的重试记录,下次调谐立即重试
+func ResetModuleRetries(c *v1.Cluster) {
+	c.Status.Retries = nil
+	if v1.GetCondition(c.Status.Conditions, v1.ConditionFailed) != nil {
+		v1.SetCondition(&c.Status.Conditions, v1.ConditionFailed, v12.ConditionFalse, "ForceReconcile", "")
+	}
+}
+
+func getModuleRetry(c *v1.Cluster, module string) *v1.ClusterModuleRetryStatus {
+	for i := range c.Status.Retries {
+		if c.Status.Retries[i].Module == module {
+			return &c.Status.Retries[i]
+		}
+	}
+	return nil
+}
+
+func retryPolicy(c *v1.Cluster) (int32, time.Duration, time.Duration) {
+	spec := c.Spec.Retry
+	maxAttempts, base, max := defaultRetryMaxAttempts, defaultRetryBaseDelay, defaultRetryMaxDelay
+	if spec.MaxAttempts > 0 {
+		maxAttempts = spec.MaxAttempts
+	}
+	if spec.BaseDelay != nil && spec.BaseDelay.Duration > 0 {
+		base = spec.BaseDelay.Duration
+	}
+	if spec.MaxDelay != nil && spec.MaxDelay.Duration > 0 {
+		max = spec.MaxDelay.Duration
+	}
+	return maxAttempts, base, max
+}
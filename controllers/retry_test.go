@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	v1 "github.com/kok-stack/kok/api/v1"
+	v12 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// retryCluster 重试间隔为1s到4s的集群
+func retryCluster(maxAttempts int32) *v1.Cluster {
+	c := testCluster("c")
+	c.Generation = 1
+	c.Spec.Retry.MaxAttempts = maxAttempts
+	c.Spec.Retry.BaseDelay = &metav1.Duration{Duration: time.Second}
+	c.Spec.Retry.MaxDelay = &metav1.Duration{Duration: 4 * time.Second}
+	return c
+}
+
+// withinJitter d是否在base到base*(1+retryJitter)之间
+func withinJitter(d, base time.Duration) bool {
+	return d >= base && d <= time.Duration(float64(base)*(1+retryJitter))
+}
+
+func TestRecordModuleFailure(t *testing.T) {
+	c := retryCluster(5)
+	err := errors.New("boom")
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		if d := RecordModuleFailure(c, "etcd", err); !withinJitter(d, want) {
+			t.Errorf("attempt %d: delay = %v, want about %v", i+1, d, want)
+		}
+	}
+	r := getModuleRetry(c, "etcd")
+	if r == nil || r.Attempts != 4 || r.LastError != "boom" || r.NextRetryTime == nil {
+		t.Fatalf("unexpected retry status %+v", r)
+	}
+	if v1.GetCondition(c.Status.Conditions, v1.ConditionFailed) != nil {
+		t.Fatal("failed before max attempts")
+	}
+
+	if d := RecordModuleFailure(c, "etcd", err); d != 0 {
+		t.Errorf("delay after max attempts = %v, want 0", d)
+	}
+	cond := v1.GetCondition(c.Status.Conditions, v1.ConditionFailed)
+	if cond == nil || cond.Status != v12.ConditionTrue {
+		t.Fatalf("Failed condition = %+v", cond)
+	}
+	if _, failed := ModuleBackoff(c, "etcd"); !failed {
+		t.Error("ModuleBackoff() not failed after max attempts")
+	}
+
+	ClearModuleRetry(c, "etcd")
+	if len(c.Status.Retries) != 0 {
+		t.Errorf("retries not cleared: %v", c.Status.Retries)
+	}
+	if cond := v1.GetCondition(c.Status.Conditions, v1.ConditionFailed); cond.Status != v12.ConditionFalse {
+		t.Errorf("Failed condition not cleared: %+v", cond)
+	}
+}
+
+func TestModuleBackoff(t *testing.T) {
+	c := retryCluster(0)
+	if d, failed := ModuleBackoff(c, "etcd"); d != 0 || failed {
+		t.Errorf("ModuleBackoff() without failures = %v, %v", d, failed)
+	}
+
+	RecordModuleFailure(c, "etcd", errors.New("boom"))
+	d, failed := ModuleBackoff(c, "etcd")
+	if failed || d <= 0 || d > 2*time.Second {
+		t.Errorf("ModuleBackoff() = %v, %v", d, failed)
+	}
+	if d, _ := ModuleBackoff(c, "apiserver"); d != 0 {
+		t.Errorf("other module delay = %v", d)
+	}
+
+	//spec变化后立即重试
+	c.Generation = 2
+	if d, failed := ModuleBackoff(c, "etcd"); d != 0 || failed {
+		t.Errorf("ModuleBackoff() after spec change = %v, %v", d, failed)
+	}
+	if getModuleRetry(c, "etcd") != nil {
+		t.Error("retry not cleared after spec change")
+	}
+}
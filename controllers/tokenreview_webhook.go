@@ -0,0 +1,257 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"github.com/go-logr/logr"
+	clusterv1 "github.com/kok-stack/kok/api/v1"
+	authv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+	"time"
+)
+
+const TokenReviewPath = "/tokenreview/"
+
+// guest apiserver使用集群CA签发的kubernetes-server证书作为客户端证书调用token review webhook
+const (
+	TokenReviewClientCert = "/pki/server/kubernetes-server.pem"
+	TokenReviewClientKey  = "/pki/server/kubernetes-server-key.pem"
+	//kubernetes-server证书的CN,见initjob/init.sh
+	TokenReviewClientCommonName = "kubernetes-admin"
+)
+
+const serviceAccountUsernamePrefix = "system:serviceaccount:"
+
+// TokenReviewConfig guest apiserver访问kok token review webhook的地址和CA
+type TokenReviewConfig struct {
+	URL    string
+	CAData []byte
+}
+
+var HostTokenReview = &TokenReviewConfig{}
+
+// Enabled 读取到CA时才启动token review server
+func (c *TokenReviewConfig) Enabled() bool {
+	return len(c.CAData) > 0
+}
+
+func (c *TokenReviewConfig) ClusterURL(cluster *clusterv1.Cluster) string {
+	return fmt.Sprintf("%s%s%s/%s", strings.TrimSuffix(c.URL, "/"), TokenReviewPath, cluster.Namespace, cluster.Name)
+}
+
+// TokenReviewServer 独立监听token review webhook.webhook server不请求客户端证书,
+// 这里要求客户端证书,由HostTokenReviewer按集群CA校验
+type TokenReviewServer struct {
+	Addr string
+	//与webhook server共用的serving证书目录
+	CertDir string
+	Handler http.Handler
+}
+
+func (s *TokenReviewServer) Start(stop <-chan struct{}) error {
+	certDir := s.CertDir
+	if certDir == "" {
+		//与webhook server的默认值一致
+		certDir = filepath.Join(os.TempDir(), "k8s-webhook-server", "serving-certs")
+	}
+	certFile := filepath.Join(certDir, "tls.crt")
+	keyFile := filepath.Join(certDir, "tls.key")
+	cfg := &tls.Config{
+		ClientAuth: tls.RequireAnyClientCert,
+		//每次握手重新读取,证书轮换后无需重启
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			return &cert, err
+		},
+	}
+	listener, err := tls.Listen("tcp", s.Addr, cfg)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(TokenReviewPath, s.Handler)
+	srv := &http.Server{Handler: mux}
+	go func() {
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}()
+	if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection 所有副本都需要处理token review
+func (s *TokenReviewServer) NeedLeaderElection() bool {
+	return false
+}
+
+// HostTokenReviewer 将guest apiserver发来的TokenReview转发到host集群,并按ServiceAccountMapping映射用户
+type HostTokenReviewer struct {
+	client.Client
+	Log logr.Logger
+}
+
+// +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+// +kubebuilder:rbac:groups=cluster.kok.tanx,resources=serviceaccountmappings,verbs=get;list;watch
+
+func (h *HostTokenReviewer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	review := &authv1.TokenReview{}
+	if err := json.NewDecoder(r.Body).Decode(review); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	split := strings.Split(strings.TrimPrefix(r.URL.Path, TokenReviewPath), "/")
+	if len(split) != 2 {
+		http.Error(w, "invalid path", http.StatusNotFound)
+		return
+	}
+	name := types.NamespacedName{Namespace: split[0], Name: split[1]}
+	log := h.Log.WithValues("cluster", name)
+	if err := h.verifyClient(r.Context(), name, r.TLS); err != nil {
+		log.Info("unauthorized token review request", "error", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	status, err := h.review(r.Context(), name, review.Spec)
+	if err != nil {
+		log.Info("review token error", "error", err)
+		status = authv1.TokenReviewStatus{Error: err.Error()}
+	}
+	out := &authv1.TokenReview{
+		TypeMeta: review.TypeMeta,
+		Status:   status,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		log.Info("write token review response error", "error", err)
+	}
+}
+
+// verifyClient 只接受由该集群CA签发的apiserver客户端证书,避免其他集群或ClusterCredential签发的用户证书冒用路径中的集群
+func (h *HostTokenReviewer) verifyClient(ctx context.Context, name types.NamespacedName, state *tls.ConnectionState) error {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("client certificate required")
+	}
+	if cn := state.PeerCertificates[0].Subject.CommonName; cn != TokenReviewClientCommonName {
+		return fmt.Errorf("client certificate %s is not the apiserver", cn)
+	}
+	cluster := &clusterv1.Cluster{}
+	if err := h.Get(ctx, name, cluster); err != nil {
+		return err
+	}
+	if cluster.Status.Init.CaPkiName == "" {
+		return fmt.Errorf("cluster ca not initialized")
+	}
+	secret := &v1.Secret{}
+	if err := h.Get(ctx, types.NamespacedName{Namespace: name.Namespace, Name: cluster.Status.Init.CaPkiName}, secret); err != nil {
+		return err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(secret.Data["ca.pem"]) {
+		return fmt.Errorf("invalid cluster ca")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err
+}
+
+// review 使用该集群专用的audience在host集群校验token,返回guest apiserver请求的audience,
+// guest apiserver会将返回的audience与自身的--api-audiences求交集
+func (h *HostTokenReviewer) review(ctx context.Context, name types.NamespacedName, spec authv1.TokenReviewSpec) (authv1.TokenReviewStatus, error) {
+	cluster := &clusterv1.Cluster{}
+	if err := h.Get(ctx, name, cluster); err != nil {
+		return authv1.TokenReviewStatus{}, err
+	}
+	a := cluster.Spec.ApiServerSpec.Authentication
+	if a == nil || a.HostServiceAccount == nil {
+		return authv1.TokenReviewStatus{}, fmt.Errorf("cluster %s not trust host service account", name)
+	}
+	//audiences为空时host apiserver按默认audience校验,任何host token都会通过
+	if len(a.HostServiceAccount.Audiences) == 0 {
+		return authv1.TokenReviewStatus{}, fmt.Errorf("cluster %s host service account audiences not set", name)
+	}
+
+	hostReview := &authv1.TokenReview{
+		Spec: authv1.TokenReviewSpec{
+			Token:     spec.Token,
+			Audiences: a.HostServiceAccount.Audiences,
+		},
+	}
+	if err := h.Create(ctx, hostReview); err != nil {
+		return authv1.TokenReviewStatus{}, err
+	}
+	if !hostReview.Status.Authenticated {
+		return authv1.TokenReviewStatus{Error: hostReview.Status.Error}, nil
+	}
+
+	saNamespace, saName, ok := splitServiceAccountUsername(hostReview.Status.User.Username)
+	if !ok {
+		return authv1.TokenReviewStatus{}, fmt.Errorf("%s is not a service account", hostReview.Status.User.Username)
+	}
+	mappings := &clusterv1.ServiceAccountMappingList{}
+	if err := h.List(ctx, mappings, client.InNamespace(name.Namespace)); err != nil {
+		return authv1.TokenReviewStatus{}, err
+	}
+	for _, m := range mappings.Items {
+		if m.Spec.ClusterName != name.Name || m.Spec.ServiceAccount.Namespace != saNamespace || m.Spec.ServiceAccount.Name != saName {
+			continue
+		}
+		return authv1.TokenReviewStatus{
+			Authenticated: true,
+			User: authv1.UserInfo{
+				Username: m.Spec.Username,
+				UID:      hostReview.Status.User.UID,
+				Groups:   m.Spec.Groups,
+			},
+			Audiences: spec.Audiences,
+		}, nil
+	}
+	return authv1.TokenReviewStatus{}, fmt.Errorf("service account %s/%s not mapped", saNamespace, saName)
+}
+
+func splitServiceAccountUsername(username string) (string, string, bool) {
+	if !strings.HasPrefix(username, serviceAccountUsernamePrefix) {
+		return "", "", false
+	}
+	split := strings.Split(strings.TrimPrefix(username, serviceAccountUsernamePrefix), ":")
+	if len(split) != 2 || split[0] == "" || split[1] == "" {
+		return "", "", false
+	}
+	return split[0], split[1], true
+}
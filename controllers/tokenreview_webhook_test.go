@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	clusterv1 "github.com/kok-stack/kok/api/v1"
+	authv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestHostTokenReviewerVerifyClient(t *testing.T) {
+	ca, caKey := testCert(t, "ca", true, nil, nil, nil)
+	other, otherKey := testCert(t, "other", true, nil, nil, nil)
+	client, _ := testCert(t, "kubernetes-admin", false, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, ca, caKey)
+	serverOnly, _ := testCert(t, "kubernetes-admin", false, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, ca, caKey)
+	foreign, _ := testCert(t, "kubernetes-admin", false, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, other, otherKey)
+	credential, _ := testCert(t, "alice", false, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, ca, caKey)
+
+	cluster := testCluster("c")
+	cluster.Status.Init.CaPkiName = "c-ca"
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "c-ca", Namespace: "test"},
+		Data:       map[string][]byte{"ca.pem": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})},
+	}
+	h := &HostTokenReviewer{Client: fake.NewFakeClientWithScheme(testScheme(t), cluster, secret)}
+	name := types.NamespacedName{Namespace: "test", Name: "c"}
+
+	tests := []struct {
+		name  string
+		state *tls.ConnectionState
+		ok    bool
+	}{
+		{name: "cluster client cert", state: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{client}}, ok: true},
+		{name: "no tls", state: nil},
+		{name: "no client cert", state: &tls.ConnectionState{}},
+		{name: "other cluster ca", state: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{foreign}}},
+		{name: "cluster credential cert", state: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{credential}}},
+		{name: "server auth only", state: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{serverOnly}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := h.verifyClient(context.Background(), name, tt.state)
+			if (err == nil) != tt.ok {
+				t.Errorf("verifyClient() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+// hostTokenClient 模拟host apiserver的TokenReview,只认证指定audience下的token
+type hostTokenClient struct {
+	client.Client
+	audience string
+	tokens   map[string]string
+}
+
+func (c *hostTokenClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	review, ok := obj.(*authv1.TokenReview)
+	if !ok {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+	username, ok := c.tokens[review.Spec.Token]
+	if !ok || len(review.Spec.Audiences) != 1 || review.Spec.Audiences[0] != c.audience {
+		review.Status = authv1.TokenReviewStatus{Error: "invalid token"}
+		return nil
+	}
+	review.Status = authv1.TokenReviewStatus{
+		Authenticated: true,
+		User:          authv1.UserInfo{Username: username, UID: "uid"},
+		Audiences:     review.Spec.Audiences,
+	}
+	return nil
+}
+
+func TestHostTokenReviewerReview(t *testing.T) {
+	cluster := testCluster("c")
+	cluster.Spec.ApiServerSpec.Authentication = &clusterv1.ClusterAuthenticationSpec{
+		HostServiceAccount: &clusterv1.ClusterHostServiceAccountSpec{Audiences: []string{"kok-test-c"}},
+	}
+	mapping := &clusterv1.ServiceAccountMapping{ObjectMeta: metav1.ObjectMeta{Name: "m", Namespace: "test"}}
+	mapping.Spec.ClusterName = "c"
+	mapping.Spec.ServiceAccount.Namespace = "app"
+	mapping.Spec.ServiceAccount.Name = "mapped"
+	mapping.Spec.Username = "guest-user"
+	mapping.Spec.Groups = []string{"guest-group"}
+	h := &HostTokenReviewer{Client: &hostTokenClient{
+		Client:   fake.NewFakeClientWithScheme(testScheme(t), cluster, mapping),
+		audience: "kok-test-c",
+		tokens: map[string]string{
+			"mapped":   "system:serviceaccount:app:mapped",
+			"unmapped": "system:serviceaccount:app:other",
+		},
+	}}
+	name := types.NamespacedName{Namespace: "test", Name: "c"}
+	//guest apiserver默认的--api-audiences
+	guestAudiences := []string{"https://kubernetes.default.svc"}
+
+	status, err := h.review(context.Background(), name, authv1.TokenReviewSpec{Token: "mapped", Audiences: guestAudiences})
+	if err != nil || !status.Authenticated {
+		t.Fatalf("review() = %+v, %v", status, err)
+	}
+	if status.User.Username != "guest-user" || status.User.UID != "uid" || len(status.User.Groups) != 1 || status.User.Groups[0] != "guest-group" {
+		t.Errorf("user = %+v", status.User)
+	}
+	//返回的audience需要与guest apiserver的audience有交集
+	if len(status.Audiences) != 1 || status.Audiences[0] != guestAudiences[0] {
+		t.Errorf("audiences = %v, want %v", status.Audiences, guestAudiences)
+	}
+
+	if _, err := h.review(context.Background(), name, authv1.TokenReviewSpec{Token: "unmapped", Audiences: guestAudiences}); err == nil {
+		t.Error("unmapped service account authenticated")
+	}
+	if status, err := h.review(context.Background(), name, authv1.TokenReviewSpec{Token: "invalid"}); err != nil || status.Authenticated {
+		t.Errorf("invalid token review() = %+v, %v", status, err)
+	}
+}
@@ -6,6 +6,50 @@ echo '==================init variable==================='
 NAMESPACE=$(cat /var/run/secrets/kubernetes.io/serviceaccount/namespace)
 echo "$NAMESPACE"
 
+# job重跑时(失败重试,remediation,重建,ttl清理后):全部secret已存在则跳过,否则只生成缺少的secret.
+# 已有的CA不会删除或重新生成,其他证书由已有的CA签发
+SECRETS="${CA_PKI_NAME} ${ETCD_PKI_PEER_NAME} ${ETCD_PKI_SERVER_NAME} ${ETCD_PKI_CLIENT_NAME} ${K8S_SERVER_NAME} ${K8S_CLIENT_NAME} ${ADMIN_CONFIG_NAME} ${FRONT_PROXY_PKI_NAME} ${NODE_CONFIG_NAME}"
+secret_exists() {
+  kubectl get secret "$1" >/dev/null 2>&1
+}
+# create_secret 只在secret不存在时创建
+create_secret() {
+  name=$1
+  shift
+  if secret_exists "${name}"; then
+    echo "secret ${name} exists, keep it"
+    return 0
+  fi
+  kubectl create secret generic "${name}" "$@"
+}
+# secret_file 将secret中的key写入文件
+secret_file() {
+  kubectl get secret "$1" -o "jsonpath={.data.$(echo "$2" | sed 's/\./\\./g')}" | base64 -d >"$3"
+  test -s "$3"
+}
+EXISTS=true
+for s in ${SECRETS}; do
+  if ! secret_exists "${s}"; then
+    EXISTS=false
+  fi
+done
+if [ "${EXISTS}" = "true" ]; then
+  echo 'all secrets exist, skip init'
+  exit 0
+fi
+CA_EXISTS=false
+if secret_exists "${CA_PKI_NAME}"; then
+  CA_EXISTS=true
+else
+  # CA丢失而由其签发的证书仍在时,重新生成CA会使集群证书失效,需人工处理
+  for s in ${ETCD_PKI_PEER_NAME} ${ETCD_PKI_SERVER_NAME} ${ETCD_PKI_CLIENT_NAME} ${K8S_SERVER_NAME} ${K8S_CLIENT_NAME} ${ADMIN_CONFIG_NAME} ${NODE_CONFIG_NAME}; do
+    if secret_exists "${s}"; then
+      echo "ERROR: CA secret ${CA_PKI_NAME} is missing but ${s} exists, refuse to generate a new CA" >&2
+      exit 1
+    fi
+  done
+fi
+
 echo '==================generator ssl==================='
 
 mkdir -p /home/test && cd /home/test
@@ -58,7 +102,14 @@ cat <<EOF >ca-csr.json
 }
 EOF
 
-cfssl gencert -initca ca-csr.json | cfssljson -bare ca
+if [ "${CA_EXISTS}" = "true" ]; then
+  echo "use existing CA from ${CA_PKI_NAME}"
+  secret_file "${CA_PKI_NAME}" ca.pem ca.pem
+  secret_file "${CA_PKI_NAME}" ca-key.pem ca-key.pem
+  secret_file "${CA_PKI_NAME}" ca.csr ca.csr || true
+else
+  cfssl gencert -initca ca-csr.json | cfssljson -bare ca
+fi
 
 ls -la
 
@@ -161,6 +212,38 @@ EOF
 
 cfssl gencert -ca=ca.pem -ca-key=ca-key.pem -config=ca-config.json -profile=kubernetes k8s-server-csr.json | cfssljson -bare kubernetes-server
 
+cat <<EOF >front-proxy-ca-csr.json
+{
+  "CN": "front-proxy-ca",
+  "key": {
+    "algo": "rsa",
+    "size": 2048
+  }
+}
+EOF
+
+if secret_exists "${FRONT_PROXY_PKI_NAME}"; then
+  secret_file "${FRONT_PROXY_PKI_NAME}" front-proxy-ca.pem front-proxy-ca.pem
+  secret_file "${FRONT_PROXY_PKI_NAME}" front-proxy-ca-key.pem front-proxy-ca-key.pem
+else
+  cfssl gencert -initca front-proxy-ca-csr.json | cfssljson -bare front-proxy-ca
+fi
+
+cat <<EOF >front-proxy-client-csr.json
+{
+    "CN": "front-proxy-client",
+    "hosts": [
+
+    ],
+    "key": {
+        "algo": "rsa",
+        "size": 2048
+    }
+}
+EOF
+
+cfssl gencert -ca=front-proxy-ca.pem -ca-key=front-proxy-ca-key.pem -config=ca-config.json -profile=kubernetes front-proxy-client-csr.json | cfssljson -bare front-proxy-client
+
 kubectl config --kubeconfig=admin.config set-cluster kubernetes --certificate-authority=/home/test/ca.pem --embed-certs=true --server=https://"${APISERVER_ADDRESS}"."${NAMESPACE}":6443
 kubectl config --kubeconfig=admin.config set-credentials kubernetes-admin --embed-certs=true --client-certificate=/home/test/kubernetes-server.pem --client-key=/home/test/kubernetes-server-key.pem
 kubectl config --kubeconfig=admin.config set-context kubernetes --cluster=kubernetes --namespace=default --user=kubernetes-admin
@@ -171,15 +254,16 @@ cat admin.config
 echo '==============admin.config======================='
 
 #kubectl create secret generic pki --from-file=ca-config.json --from-file=ca-csr.json --from-file=ca-key.pem --from-file=ca.csr --from-file=ca.pem --from-file=etcd-csr.json --from-file=etcd-key.pem --from-file=etcd.csr --from-file=etcd.pem --from-file=k8s-client-csr.json --from-file=k8s-server-csr.json --from-file=kubernetes-node-key.pem --from-file=kubernetes-node.csr --from-file=kubernetes-node.pem --from-file=kubernetes-server-key.pem --from-file=kubernetes-server.csr --from-file=kubernetes-server.pem
-kubectl create secret generic "${CA_PKI_NAME}" --from-file=ca-config.json --from-file=ca-csr.json --from-file=ca-key.pem --from-file=ca.csr --from-file=ca.pem
+create_secret "${CA_PKI_NAME}" --from-file=ca-config.json --from-file=ca-csr.json --from-file=ca-key.pem --from-file=ca.csr --from-file=ca.pem
 
-kubectl create secret generic "${ETCD_PKI_PEER_NAME}" --from-file=peer-ca.crt=ca.pem --from-file=peer.crt=etcd.pem --from-file=peer.key=etcd-key.pem
-kubectl create secret generic "${ETCD_PKI_SERVER_NAME}" --from-file=server-ca.crt=ca.pem --from-file=server.crt=etcd.pem --from-file=server.key=etcd-key.pem
-kubectl create secret generic "${ETCD_PKI_CLIENT_NAME}" --from-file=etcd-client-ca.crt=ca.pem --from-file=etcd-client.crt=etcd.pem --from-file=etcd-client.key=etcd-key.pem
+create_secret "${ETCD_PKI_PEER_NAME}" --from-file=peer-ca.crt=ca.pem --from-file=peer.crt=etcd.pem --from-file=peer.key=etcd-key.pem
+create_secret "${ETCD_PKI_SERVER_NAME}" --from-file=server-ca.crt=ca.pem --from-file=server.crt=etcd.pem --from-file=server.key=etcd-key.pem
+create_secret "${ETCD_PKI_CLIENT_NAME}" --from-file=etcd-client-ca.crt=ca.pem --from-file=etcd-client.crt=etcd.pem --from-file=etcd-client.key=etcd-key.pem
 
-kubectl create secret generic "${K8S_SERVER_NAME}" --from-file=k8s-server-csr.json --from-file=kubernetes-server-key.pem --from-file=kubernetes-server.csr --from-file=kubernetes-server.pem
-kubectl create secret generic "${K8S_CLIENT_NAME}" --from-file=k8s-client-csr.json --from-file=kubernetes-node-key.pem --from-file=kubernetes-node.csr --from-file=kubernetes-node.pem
-kubectl create secret generic "${ADMIN_CONFIG_NAME}" --from-file=admin.config
+create_secret "${K8S_SERVER_NAME}" --from-file=k8s-server-csr.json --from-file=kubernetes-server-key.pem --from-file=kubernetes-server.csr --from-file=kubernetes-server.pem
+create_secret "${K8S_CLIENT_NAME}" --from-file=k8s-client-csr.json --from-file=kubernetes-node-key.pem --from-file=kubernetes-node.csr --from-file=kubernetes-node.pem
+create_secret "${ADMIN_CONFIG_NAME}" --from-file=admin.config
+create_secret "${FRONT_PROXY_PKI_NAME}" --from-file=front-proxy-ca.pem --from-file=front-proxy-ca-key.pem --from-file=front-proxy-client.pem --from-file=front-proxy-client-key.pem
 
 kubectl config --kubeconfig=node.config set-cluster kubernetes --certificate-authority=/home/test/ca.pem --embed-certs=true --server=https://"${FRONT_APISERVER_ADDRESS}"."${NAMESPACE}":"${FRONT_APISERVER_PORT}"
 kubectl config --kubeconfig=node.config set-credentials kubernetes-node --embed-certs=true --client-certificate=/home/test/kubernetes-node.pem --client-key=/home/test/kubernetes-node-key.pem
@@ -189,4 +273,4 @@ kubectl config --kubeconfig=node.config set current-context kubernetes
 echo '==============node.config======================='
 cat node.config
 echo '==============node.config======================='
-kubectl create secret generic "${NODE_CONFIG_NAME}" --from-file=node.config
+create_secret "${NODE_CONFIG_NAME}" --from-file=node.config
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	_ "github.com/kok-stack/kok/controllers/cluster-arm"
 	_ "github.com/kok-stack/kok/controllers/cluster-x86"
+	"io/ioutil"
 	"os"
 	"strings"
 
@@ -29,6 +30,7 @@ import (
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	clusterv1 "github.com/kok-stack/kok/api/v1"
 	"github.com/kok-stack/kok/controllers"
@@ -51,10 +53,19 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var tokenReviewURL string
+	var tokenReviewCAFile string
+	var tokenReviewAddr string
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&tokenReviewURL, "token-review-url", "https://kok-webhook-service.kok-system.svc:9444",
+		"The address guest apiservers use to reach the host token review webhook.")
+	flag.StringVar(&tokenReviewCAFile, "token-review-ca-file", "/tmp/k8s-webhook-server/serving-certs/ca.crt",
+		"The CA file guest apiservers use to verify the host token review webhook. Host token review is disabled when it cannot be read.")
+	flag.StringVar(&tokenReviewAddr, "token-review-bind-address", ":9444",
+		"The address the token review webhook binds to. Clients must present their cluster apiserver certificate.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
@@ -80,6 +91,22 @@ func main() {
 		os.Exit(1)
 	}
 
+	controllers.HostTokenReview.URL = tokenReviewURL
+	//未使用hostServiceAccount的部署可以没有该文件,此时不启动token review server,webhook拒绝配置hostServiceAccount的集群
+	if controllers.HostTokenReview.CAData, err = ioutil.ReadFile(tokenReviewCAFile); err != nil {
+		setupLog.Info("unable to read token review ca file, host token review disabled", "file", tokenReviewCAFile, "error", err.Error())
+	} else if err = mgr.Add(&controllers.TokenReviewServer{
+		Addr:    tokenReviewAddr,
+		CertDir: mgr.GetWebhookServer().CertDir,
+		Handler: &controllers.HostTokenReviewer{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("webhooks").WithName("TokenReview"),
+		},
+	}); err != nil {
+		setupLog.Error(err, "unable to create token review server")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.ClusterReconciler{
 		Client:   mgr.GetClient(),
 		Log:      ctrl.Log.WithName("controllers").WithName("Cluster"),
@@ -102,6 +129,9 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "ClusterPlugin")
 		os.Exit(1)
 	}
+	mgr.GetWebhookServer().Register(controllers.ClusterPluginValidatePath, &webhook.Admission{
+		Handler: &controllers.ClusterPluginValidator{Client: mgr.GetClient()},
+	})
 	if err = (&controllers.MultiClusterPluginReconciler{
 		Client:   mgr.GetClient(),
 		Log:      ctrl.Log.WithName("controllers").WithName("MultiClusterPlugin"),
@@ -111,6 +141,21 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "MultiClusterPlugin")
 		os.Exit(1)
 	}
+	mgr.GetWebhookServer().Register(controllers.MultiClusterPluginValidatePath, &webhook.Admission{
+		Handler: &controllers.MultiClusterPluginValidator{},
+	})
+	if err = (&controllers.ClusterCredentialReconciler{
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("ClusterCredential"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("ClusterCredential"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterCredential")
+		os.Exit(1)
+	}
+	mgr.GetWebhookServer().Register(controllers.ClusterCredentialValidatePath, &webhook.Admission{
+		Handler: &controllers.ClusterCredentialValidator{},
+	})
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")